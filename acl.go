@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"net"
+	"strings"
+)
+
+// cidrList is a repeatable flag of CIDR networks
+type cidrList []*net.IPNet
+
+func (l *cidrList) String() string {
+	if l == nil {
+		return ""
+	}
+	s := make([]string, len(*l))
+	for i, n := range *l {
+		s[i] = n.String()
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *cidrList) Set(value string) error {
+	_, n, err := net.ParseCIDR(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, n)
+	return nil
+}
+
+func (l cidrList) contains(ip net.IP) bool {
+	for _, n := range l {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAllowed checks the client address against the allow and
+// deny lists. An allow match always wins over a deny match; if
+// any allow networks are given, unlisted clients are denied.
+func clientAllowed(remoteAddr string) bool {
+	if len(allowCIDR) == 0 && len(denyCIDR) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	switch {
+	case allowCIDR.contains(ip):
+		return true
+	case denyCIDR.contains(ip):
+		return false
+	default:
+		return len(allowCIDR) == 0
+	}
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRestrictClients(t *testing.T) {
+	loadPool(t, "a quote\n")
+	tests := []struct {
+		name   string
+		allow  []string
+		deny   []string
+		remote string
+		want   int
+	}{
+		{"no lists", nil, nil, "192.0.2.1:1234", 200},
+		{"allowed", []string{"192.0.2.0/24"}, nil, "192.0.2.1:1234", 200},
+		{"not allowed", []string{"192.0.2.0/24"}, nil, "198.51.100.1:1234", 403},
+		{"denied", nil, []string{"192.0.2.0/24"}, "192.0.2.1:1234", 403},
+		{"not denied", nil, []string{"192.0.2.0/24"}, "198.51.100.1:1234", 200},
+		{"allow wins", []string{"192.0.2.1/32"}, []string{"192.0.2.0/24"}, "192.0.2.1:1234", 200},
+		{"allow wins, denied", []string{"192.0.2.1/32"}, []string{"192.0.2.0/24"}, "192.0.2.2:1234", 403},
+		{"ipv6", []string{"2001:db8::/32"}, nil, "[2001:db8::1]:1234", 200},
+		{"ipv6 not allowed", []string{"2001:db8::/32"}, nil, "[::1]:1234", 403},
+		{"ipv4-mapped", nil, []string{"192.0.2.0/24"}, "[::ffff:192.0.2.1]:1234", 403},
+		{"no port", nil, []string{"192.0.2.0/24"}, "192.0.2.1", 403},
+		{"unparseable", nil, []string{"192.0.2.0/24"}, "@", 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allow, deny := allowCIDR, denyCIDR
+			allowCIDR, denyCIDR = nil, nil
+			defer func() { allowCIDR, denyCIDR = allow, deny }()
+			for _, cidr := range tt.allow {
+				if err := allowCIDR.Set(cidr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, cidr := range tt.deny {
+				if err := denyCIDR.Set(cidr); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			h := chain(quoteMiddlewares()...)(http.HandlerFunc(handleQuote))
+			req := httptest.NewRequest("GET", "/quote", nil)
+			req.RemoteAddr = tt.remote
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got %d; want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	var l cidrList
+	if err := l.Set("not a network"); err == nil {
+		t.Error("accepted an invalid CIDR")
+	}
+}
@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"unicode/utf8"
+)
+
+// setQuotes swaps in a new pool; quotesM must be held for writing
+func setQuotes(qs []Quote) {
+	pool.Set(qs)
+	resetRecent()
+}
+
+// biasWeights weighs quotes by their length, favouring either
+// short or long quotes
+func biasWeights(qs []Quote) []float64 {
+	if bias == "none" {
+		return nil
+	}
+
+	weights := make([]float64, len(qs))
+	for i, q := range qs {
+		n := float64(utf8.RuneCountInString(q.Text) + 1)
+		if bias == "short" {
+			weights[i] = 1 / n
+		} else {
+			weights[i] = n
+		}
+	}
+	return weights
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestBias(t *testing.T) {
+	short, long := "short", strings.Repeat("long ", 20)
+	tests := []struct {
+		bias     string
+		min, max float64 // expected share of short picks
+	}{
+		{"none", 0.45, 0.55},
+		{"short", 0.85, 1},
+		{"long", 0, 0.15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.bias, func(t *testing.T) {
+			setFlag(t, "bias", tt.bias)
+			loadPool(t, short+"\n\n"+long+"\n")
+			rand.Seed(1)
+
+			const n = 10000
+			shorts := 0
+			for i := 0; i < n; i++ {
+				if _, q := selectQuote(); q.Text == short {
+					shorts++
+				}
+			}
+			if share := float64(shorts) / n; share < tt.min || share > tt.max {
+				t.Errorf("short quote picked %.1f%% of the time; want %.0f%% to %.0f%%", share*100, tt.min*100, tt.max*100)
+			}
+		})
+	}
+}
+
+func TestBiasWeights(t *testing.T) {
+	qs := []Quote{{Text: "a"}, {Text: "äää"}}
+	tests := []struct {
+		bias string
+		want []float64
+	}{
+		{"none", nil},
+		{"short", []float64{1.0 / 2, 1.0 / 4}},
+		{"long", []float64{2, 4}},
+	}
+	for _, tt := range tests {
+		setFlag(t, "bias", tt.bias)
+		got := biasWeights(qs)
+		if len(got) != len(tt.want) {
+			t.Errorf("-bias %s: weights %v; want %v", tt.bias, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("-bias %s: weights %v; want %v", tt.bias, got, tt.want)
+				break
+			}
+		}
+	}
+}
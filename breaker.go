@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var errBreakerOpen = errors.New("circuit breaker open")
+
+// breaker tracks consecutive fetch failures of a URL source
+type breaker struct {
+	failures int
+	openedAt time.Time
+}
+
+func (b breaker) open() bool {
+	return breakerThreshold > 0 && b.failures >= breakerThreshold &&
+		time.Since(b.openedAt) < breakerCooldown
+}
+
+var (
+	breakers  = map[string]*breaker{}
+	breakersM sync.Mutex
+)
+
+// guardFetch calls fetch unless the breaker of source is open,
+// tripping it after -breaker-threshold consecutive failures;
+// once the cooldown passes a single attempt is let through
+func guardFetch(ctx context.Context, source string, fetch func(context.Context, string) ([]Quote, error)) ([]Quote, error) {
+	if breakerThreshold <= 0 {
+		return fetch(ctx, source)
+	}
+
+	breakersM.Lock()
+	b, ok := breakers[source]
+	if !ok {
+		b = &breaker{}
+		breakers[source] = b
+	}
+	if b.open() {
+		breakersM.Unlock()
+		return []Quote{}, errBreakerOpen
+	}
+	breakersM.Unlock()
+
+	qs, err := fetch(ctx, source)
+
+	breakersM.Lock()
+	defer breakersM.Unlock()
+	switch {
+	case ctx.Err() != nil:
+		// aborted on our end; that says nothing about the source
+	case err != nil && err != errUnchanged:
+		b.failures++
+		if b.failures >= breakerThreshold {
+			b.openedAt = time.Now()
+			log.Printf("%s failed %d times; pausing fetches for %v", source, b.failures, breakerCooldown)
+		}
+	default:
+		b.failures = 0
+	}
+	return qs, err
+}
+
+// handleStatus reports the health of the sources and the state
+// of their circuit breakers
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	type breakerStatus struct {
+		Source   string     `json:"source"`
+		State    string     `json:"state"`
+		Failures int        `json:"failures"`
+		RetryAt  *time.Time `json:"retry_at,omitempty"`
+	}
+	status := struct {
+		Sources  []sourceStatus  `json:"sources"`
+		Breakers []breakerStatus `json:"breakers"`
+	}{sourceStatuses(), []breakerStatus{}}
+
+	breakersM.Lock()
+	for source, b := range breakers {
+		s := breakerStatus{Source: redactSource(source), State: "closed", Failures: b.failures}
+		if b.open() {
+			retryAt := b.openedAt.Add(breakerCooldown)
+			s.State, s.RetryAt = "open", &retryAt
+		} else if breakerThreshold > 0 && b.failures >= breakerThreshold {
+			s.State = "half-open"
+		}
+		status.Breakers = append(status.Breakers, s)
+	}
+	breakersM.Unlock()
+	sort.Slice(status.Breakers, func(i, j int) bool {
+		return status.Breakers[i].Source < status.Breakers[j].Source
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	var hits int
+	failing := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if failing {
+			http.Error(w, "broken", 500)
+			return
+		}
+		w.Write([]byte("fetched quote\n"))
+	}))
+	defer srv.Close()
+
+	setFlag(t, "breaker-threshold", "2")
+	setFlag(t, "breaker-cooldown", "200ms")
+	t.Cleanup(func() { breakers = map[string]*breaker{} })
+	loadPool(t, "previous\n")
+
+	state := func() string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handleStatus(rec, httptest.NewRequest("GET", "/status", nil))
+		var status struct {
+			Breakers []struct {
+				Source, State string
+			}
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatalf("%v in %q", err, rec.Body)
+		}
+		if len(status.Breakers) != 1 || status.Breakers[0].Source != srv.URL {
+			t.Fatalf("got breakers %+v; want one for %s", status.Breakers, srv.URL)
+		}
+		return status.Breakers[0].State
+	}
+	steps := []struct {
+		name    string
+		wait    time.Duration
+		fail    bool
+		fetched bool // whether the source is hit at all
+		ok      bool
+		want    string // quote in the pool
+		state   string
+	}{
+		{"first failure", 0, true, true, false, "previous", "closed"},
+		{"tripped", 0, true, true, false, "previous", "open"},
+		{"paused", 0, false, false, true, "previous", "open"},
+		{"half-open failure", 250 * time.Millisecond, true, true, false, "previous", "open"},
+		{"still paused", 0, false, false, true, "previous", "open"},
+		{"recovered", 250 * time.Millisecond, false, true, true, "fetched quote", "closed"},
+		{"closed", 0, true, true, false, "fetched quote", "closed"},
+	}
+	for _, s := range steps {
+		time.Sleep(s.wait)
+		failing, hits = s.fail, 0
+		err := reloadQuotes(context.Background(), []string{srv.URL})
+		if (err == nil) != s.ok {
+			t.Errorf("%s: reload returned %v", s.name, err)
+		}
+		if fetched := hits > 0; fetched != s.fetched {
+			t.Errorf("%s: fetched: %v; want %v", s.name, fetched, s.fetched)
+		}
+		if got := poolTexts(); len(got) != 1 || got[0] != s.want {
+			t.Errorf("%s: pool is %q; want %q", s.name, got, s.want)
+		}
+		if got := state(); got != s.state {
+			t.Errorf("%s: breaker %s; want %s", s.name, got, s.state)
+		}
+	}
+}
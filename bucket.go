@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bucketOf hashes s into one of -buckets buckets
+func bucketOf(s string) int {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return int(h.Sum32() % uint32(buckets))
+}
+
+// clientID identifies the client by the -bucket-key cookie or
+// header, or else by its address
+func clientID(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(bucketKey, "cookie:"):
+		if c, err := r.Cookie(strings.TrimPrefix(bucketKey, "cookie:")); err == nil {
+			return c.Value
+		}
+	case strings.HasPrefix(bucketKey, "header:"):
+		if v := r.Header.Get(strings.TrimPrefix(bucketKey, "header:")); v != "" {
+			return v
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// bucketQuote picks a random quote among those in the client's
+// bucket; quotes are bucketed by hash, so a client keeps seeing
+// the same subset across reloads. It returns nil to fall back
+// to the whole pool if the bucket is empty, or if -pin, -cache
+// or -calendar fix the quote for everyone.
+func bucketQuote(w http.ResponseWriter, r *http.Request) (int, *Quote) {
+	if _, ok := calendar.day(time.Now()); ok || buckets <= 0 || pin >= 0 || cache > 0 {
+		return -1, nil
+	}
+	if strings.HasPrefix(bucketKey, "header:") {
+		w.Header().Add("Vary", strings.TrimPrefix(bucketKey, "header:"))
+	}
+	b := bucketOf(clientID(r))
+	idx, q := selectQuoteWhere(func(q *Quote) bool {
+		return bucketOf(q.Hash) == b
+	})
+	if q != nil {
+		w.Header().Set("X-Quote-Bucket", strconv.Itoa(b))
+	}
+	return idx, q
+}
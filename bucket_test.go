@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jktr/httpqotdd/qotd"
+)
+
+func TestBuckets(t *testing.T) {
+	var src []string
+	for i := 0; i < 30; i++ {
+		src = append(src, "quote "+strconv.Itoa(i))
+	}
+	tests := []struct {
+		key     string
+		request func(r *http.Request, client string)
+		vary    string
+	}{
+		{"cookie:uid", func(r *http.Request, client string) {
+			r.AddCookie(&http.Cookie{Name: "uid", Value: client})
+		}, ""},
+		{"header:X-Client", func(r *http.Request, client string) { r.Header.Set("X-Client", client) }, "X-Client"},
+		{"", func(r *http.Request, client string) { r.RemoteAddr = client + ":1234" }, ""},
+		// without the cookie, the address decides
+		{"cookie:missing", func(r *http.Request, client string) { r.RemoteAddr = client + ":1234" }, ""},
+	}
+	for _, tt := range tests {
+		t.Run("key "+tt.key, func(t *testing.T) {
+			setFlag(t, "buckets", "3")
+			setFlag(t, "bucket-key", tt.key)
+			for round, order := range []string{"forward", "reversed"} {
+				// the same subsets after the pool is reordered
+				if order == "reversed" {
+					for i, j := 0, len(src)-1; i < j; i, j = i+1, j-1 {
+						src[i], src[j] = src[j], src[i]
+					}
+				}
+				loadPool(t, strings.Join(src, "\n\n")+"\n")
+				buckets := map[int]bool{}
+				for _, client := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"} {
+					want := bucketOf(client)
+					buckets[want] = true
+					seen := map[string]bool{}
+					for i := 0; i < 50; i++ {
+						req := httptest.NewRequest("GET", "/quote", nil)
+						tt.request(req, client)
+						rec := httptest.NewRecorder()
+						handleQuote(rec, req)
+						q := strings.TrimSuffix(rec.Body.String(), "\n")
+						if got := bucketOf(qotd.Hash(q)); got != want {
+							t.Fatalf("%s round %d: got %q from bucket %d; want bucket %d", client, round, q, got, want)
+						}
+						if b := rec.Header().Get("X-Quote-Bucket"); b != strconv.Itoa(want) {
+							t.Errorf("X-Quote-Bucket %q; want %d", b, want)
+						}
+						if v := rec.Header().Get("Vary"); v != tt.vary {
+							t.Errorf("Vary %q; want %q", v, tt.vary)
+						}
+						seen[q] = true
+					}
+					if len(seen) < 2 {
+						t.Errorf("%s only ever got %v", client, seen)
+					}
+				}
+				if len(buckets) < 2 {
+					t.Fatalf("clients all in bucket %v; pick others", buckets)
+				}
+			}
+		})
+	}
+}
+
+func TestBucketsFixedQuote(t *testing.T) {
+	// -pin applies to every bucket
+	setFlag(t, "buckets", "3")
+	setFlag(t, "pin", "0")
+	loadPool(t, "zero\n\none\n\ntwo\n\nthree\n")
+	for _, addr := range []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.3:1"} {
+		req := httptest.NewRequest("GET", "/quote", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		handleQuote(rec, req)
+		if rec.Body.String() != "zero\n" || rec.Header().Get("X-Quote-Bucket") != "" {
+			t.Errorf("%s got %q in bucket %q; want the pinned quote", addr, rec.Body, rec.Header().Get("X-Quote-Bucket"))
+		}
+	}
+}
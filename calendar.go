@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jktr/httpqotdd/qotd"
+)
+
+const calendarDate = "2006-01-02"
+
+// calendarRange maps each day from start through end, in local
+// time, to the quote at its offset from start
+type calendarRange struct {
+	start, end time.Time // UTC midnights of the local dates
+}
+
+func parseCalendar(spec string) (*calendarRange, error) {
+	i := strings.IndexByte(spec, ':')
+	if i < 0 {
+		return nil, errors.New("expected start:end dates, got " + spec)
+	}
+	start, err := time.Parse(calendarDate, spec[:i])
+	if err != nil {
+		return nil, err
+	}
+	end, err := time.Parse(calendarDate, spec[i+1:])
+	if err != nil {
+		return nil, err
+	}
+	if end.Before(start) {
+		return nil, errors.New("calendar ends before it starts: " + spec)
+	}
+	return &calendarRange{start, end}, nil
+}
+
+// day returns the offset of now's local date from the start of
+// the range, if it's within it
+func (c *calendarRange) day(now time.Time) (int, bool) {
+	if c == nil {
+		return 0, false
+	}
+	// count whole dates, so DST changes don't shift the day
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	if today.Before(c.start) || today.After(c.end) {
+		return 0, false
+	}
+	return int(today.Sub(c.start).Hours() / 24), true
+}
+
+// calendarQuote returns the quote of now's day in the -calendar
+// range, wrapping around pools shorter than the range
+func calendarQuote(s *qotd.Snapshot, now time.Time) (int, *Quote) {
+	day, ok := calendar.day(now)
+	if !ok || len(s.Quotes) == 0 {
+		return -1, nil
+	}
+	idx := day % len(s.Quotes)
+	return idx, &s.Quotes[idx]
+}
@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseCalendar(t *testing.T) {
+	tests := []struct {
+		spec string
+		ok   bool
+	}{
+		{"2026-12-01:2026-12-24", true},
+		{"2026-12-01:2026-12-01", true},
+		{"2026-12-24:2026-12-01", false},
+		{"2026-12-01", false},
+		{"2026-12-01:tomorrow", false},
+		{"12/01/2026:12/24/2026", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			if _, err := parseCalendar(tt.spec); (err == nil) != tt.ok {
+				t.Errorf("got %v; want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCalendarQuote(t *testing.T) {
+	loadPool(t, "zero\n\none\n\ntwo\n\nthree\n\nfour\n")
+	saved := calendar
+	t.Cleanup(func() { calendar = saved })
+
+	nyc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		spec string
+		now  time.Time
+		want int // -1 outside the range
+	}{
+		{"2026-12-01:2026-12-24", time.Date(2026, 11, 30, 23, 59, 0, 0, time.UTC), -1},
+		{"2026-12-01:2026-12-24", time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), 0},
+		{"2026-12-01:2026-12-24", time.Date(2026, 12, 1, 23, 59, 0, 0, time.UTC), 0},
+		{"2026-12-01:2026-12-24", time.Date(2026, 12, 2, 12, 0, 0, 0, time.UTC), 1},
+		{"2026-12-01:2026-12-24", time.Date(2026, 12, 5, 12, 0, 0, 0, time.UTC), 4},
+		// longer than the pool, so it wraps around
+		{"2026-12-01:2026-12-24", time.Date(2026, 12, 6, 12, 0, 0, 0, time.UTC), 0},
+		{"2026-12-01:2026-12-24", time.Date(2026, 12, 24, 23, 59, 0, 0, time.UTC), 3},
+		{"2026-12-01:2026-12-24", time.Date(2026, 12, 25, 0, 0, 0, 0, time.UTC), -1},
+		// by the local date, across a DST change
+		{"2026-10-31:2026-11-03", time.Date(2026, 10, 31, 23, 30, 0, 0, nyc), 0},
+		{"2026-10-31:2026-11-03", time.Date(2026, 11, 1, 23, 30, 0, 0, nyc), 1},
+		{"2026-10-31:2026-11-03", time.Date(2026, 11, 2, 0, 30, 0, 0, nyc), 2},
+		{"2026-10-31:2026-11-03", time.Date(2026, 11, 3, 23, 30, 0, 0, nyc), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.now.Format(time.RFC3339), func(t *testing.T) {
+			if calendar, err = parseCalendar(tt.spec); err != nil {
+				t.Fatal(err)
+			}
+			idx, q := calendarQuote(pool.Snapshot(), tt.now)
+			if idx != tt.want || (q == nil) != (tt.want < 0) {
+				t.Fatalf("got quote %d; want %d", idx, tt.want)
+			}
+			if q != nil && q.Text != poolTexts()[tt.want] {
+				t.Errorf("got %q at %d", q.Text, idx)
+			}
+		})
+	}
+}
+
+func TestCalendarServed(t *testing.T) {
+	loadPool(t, "zero\n\none\n\ntwo\n")
+	saved := calendar
+	t.Cleanup(func() { calendar = saved })
+
+	today := time.Now().Format(calendarDate)
+	tests := []struct {
+		spec string
+		want string // or "" for any quote
+	}{
+		{today + ":" + time.Now().AddDate(0, 0, 1).Format(calendarDate), "zero\n"},
+		{time.Now().AddDate(0, 0, -2).Format(calendarDate) + ":" + today, "two\n"},
+		{"2000-01-01:2000-01-31", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			var err error
+			if calendar, err = parseCalendar(tt.spec); err != nil {
+				t.Fatal(err)
+			}
+			seen := map[string]bool{}
+			for i := 0; i < 50; i++ {
+				rec := httptest.NewRecorder()
+				handleQuote(rec, httptest.NewRequest("GET", "/quote", nil))
+				seen[rec.Body.String()] = true
+			}
+			if tt.want != "" && (len(seen) != 1 || !seen[tt.want]) {
+				t.Errorf("served %v; want only %q", seen, tt.want)
+			} else if tt.want == "" && len(seen) == 1 {
+				t.Errorf("served %v; want random quotes outside the range", seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// a wednesday
+	now := time.Date(2026, 10, 14, 12, 30, 45, 0, time.UTC)
+	day := func(d, h, m int) time.Time { return time.Date(2026, 10, d, h, m, 0, 0, time.UTC) }
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", day(14, 12, 31)},
+		{"0 0 * * *", day(15, 0, 0)},
+		{"30 12 * * *", day(15, 12, 30)},
+		{"*/15 * * * *", day(14, 12, 45)},
+		{"0,40 12-13 * * *", day(14, 12, 40)},
+		{"0 9-17/4 * * *", day(14, 13, 0)},
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", day(18, 0, 0)},
+		{"0 0 * * 7", day(18, 0, 0)},
+		{"0 0 * * 1-5", day(15, 0, 0)},
+		// restricted day of month and of week match if either does
+		{"0 0 20 * 5", day(16, 0, 0)},
+		{"0 0 1 1 *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 4 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.spec)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := c.next(now); !got.Equal(tt.want) {
+			t.Errorf("%q: next after %v is %v; want %v", tt.spec, now, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+	} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("parseCron(%q) succeeded; want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+var errNoWriter = errors.New("no writer on fifo")
+
+// loadQuotesFromFIFO reads whatever a writer sends on a named pipe
+// until it closes its end or -fifo-timeout passes; the pipe is opened
+// anew on each load, since it's spent once the writer is done
+func loadQuotesFromFIFO(ctx context.Context, fifo string) ([]Quote, error) {
+	// a blocking open would hang until a writer shows up
+	f, err := os.OpenFile(fifo, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	deadline := time.Now().Add(fifoTimeout)
+	if err := f.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for {
+		_, err := buf.ReadFrom(f)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if buf.Len() == 0 {
+				return nil, errNoWriter
+			}
+			break // the writer is still open; take what it sent so far
+		} else if err != nil {
+			return nil, err
+		}
+
+		// without a writer, reads return EOF right away; only once
+		// something was read does EOF mean the writer has finished
+		if buf.Len() > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, errNoWriter
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return parseQuotes(ctx, &buf)
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFIFO(t *testing.T) {
+	setFlag(t, "fifo-timeout", "300ms")
+	fifo := filepath.Join(t.TempDir(), "quotes")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		name  string
+		delay time.Duration // before the writer opens the pipe
+		send  string
+		hold  bool // whether the writer keeps the pipe open
+		want  string
+		err   error
+	}{
+		{"writer waiting", 0, "one\n\ntwo\n", false, "one two", nil},
+		{"writer late", 100 * time.Millisecond, "late\n", false, "late", nil},
+		{"writer kept open", 0, "partial\n\n", true, "partial", nil},
+		{"no writer", 0, "", false, "previous", errNoWriter},
+		// the pipe is opened anew after being spent
+		{"writer again", 0, "again\n", false, "again", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadPool(t, "previous\n")
+			done := make(chan struct{})
+			if tt.send == "" {
+				close(done)
+			} else {
+				go func() {
+					defer close(done)
+					time.Sleep(tt.delay)
+					// blocks until the reload opens the other end
+					f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					f.WriteString(tt.send)
+					if tt.hold {
+						time.Sleep(2 * fifoTimeout)
+					}
+					f.Close()
+				}()
+			}
+
+			err := reloadQuotes(context.Background(), []string{fifo})
+			<-done
+			if err != tt.err {
+				t.Errorf("got %v; want %v", err, tt.err)
+			}
+			if got := strings.Join(poolTexts(), " "); got != tt.want {
+				t.Errorf("pool is %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
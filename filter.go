@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// filterQuote pipes text through -filter-cmd, run by the shell
+// so that it may carry arguments, e.g. "cowsay -f tux"
+func filterQuote(text string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", filterCmd)
+	cmd.Stdin = strings.NewReader(text + "\n")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	// in a process group of its own, so that a timeout
+	// kills any pipeline the shell started as well
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("filter failed: %v", err)
+	}
+	timer := time.AfterFunc(filterTimeout, func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	})
+	err := cmd.Wait()
+	if !timer.Stop() {
+		return "", fmt.Errorf("filter timed out after %v", filterTimeout)
+	}
+	if err != nil && stderr.Len() > 0 {
+		return "", fmt.Errorf("filter failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	} else if err != nil {
+		return "", fmt.Errorf("filter failed: %v", err)
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
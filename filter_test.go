@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jktr/httpqotdd/qotd"
+)
+
+func TestFilterCmd(t *testing.T) {
+	const src = "first\n\nskip me\n\nover\ntwo lines\n"
+	tests := []struct {
+		name   string
+		cmd    string
+		want   string // quotes, joined by |
+		logged string
+	}{
+		{"upper", "tr a-z A-Z", "FIRST|SKIP ME|OVER\nTWO LINES", ""},
+		{"per line", "sed 's/^/> /'", "> first|> skip me|> over\n> two lines", ""},
+		{"failing", "grep -v skip", "first|over\ntwo lines", "quote 2: filter failed: exit status 1; skipped"},
+		{"stderr", "echo oops >&2; exit 3", "", "quote 1: filter failed: exit status 3: oops; skipped"},
+		{"silent", "grep -v skip || true", "first|over\ntwo lines", "quote 2: filter printed nothing; skipped"},
+		{"timeout", "sleep 10 | cat", "", "quote 1: filter timed out after 100ms; skipped"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "filter-cmd", tt.cmd)
+			setFlag(t, "filter-timeout", "100ms")
+			logged := captureLog(t)
+			start := time.Now()
+			qs, err := parseQuotes(context.Background(), strings.NewReader(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("took %v; want any stuck filter killed", elapsed)
+			}
+			got := []string{}
+			for _, q := range qs {
+				got = append(got, q.Text)
+				if q.Hash != qotd.Hash(q.Text) {
+					t.Errorf("%q hashed as %s", q.Text, q.Hash)
+				}
+			}
+			if strings.Join(got, "|") != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+			if !strings.Contains(logged.String(), tt.logged) {
+				t.Errorf("logged %q; want %q", logged, tt.logged)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jktr/httpqotdd/qotd"
+)
+
+// formatter renders quotes as one media type
+type formatter = qotd.Format
+
+// HTML is served by the daemon only, as it comes
+// with templates and their flags
+func init() {
+	qotd.Formats["html"] = formatter{
+		ContentType: "text/html; charset=utf-8",
+		Write: func(w io.Writer, q Quote) error {
+			return htmlQuote.Execute(w, []Quote{q})
+		},
+		WriteList: func(w io.Writer, qs []Quote) error {
+			return htmlQuote.Execute(w, qs)
+		},
+	}
+	qotd.MediaTypes["text/html"] = "html"
+}
+
+// richQuote is a -rich-json quote, along with its place in the pool
+type richQuote struct {
+	Quote
+	Index    int       `json:"index"`
+	Pool     int       `json:"pool"`
+	Source   string    `json:"source,omitempty"`
+	Reloaded time.Time `json:"reloaded"`
+}
+
+// richWriter writes quotes at index idx in a pool of size quotes
+// as richQuote JSON
+func richWriter(idx, size int) func(w io.Writer, q Quote) error {
+	return func(w io.Writer, q Quote) error {
+		quotesM.RLock()
+		rq := richQuote{q, idx, size, redactSource(q.Source), reloadedAt}
+		quotesM.RUnlock()
+		return json.NewEncoder(w).Encode(rq)
+	}
+}
+
+// templateFuncs are available to the HTML template, be it the
+// built-in one or a -template
+var templateFuncs = template.FuncMap{
+	// images are inlined at load time, and so are trusted
+	"dataURI": func(s string) template.URL { return template.URL(s) },
+
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// date formats the current time with a Go time layout
+	"date": func(layout string) string { return time.Now().Format(layout) },
+	// rand picks one of its arguments
+	"rand": func(choices ...string) string {
+		if len(choices) == 0 {
+			return ""
+		}
+		return choices[rand.Intn(len(choices))]
+	},
+}
+
+// htmlQuote renders a list of quotes as a page; it's replaced
+// by -template if given
+var htmlQuote = template.Must(template.New("quote").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Quote of the Day</title></head>
+<body>
+{{- range .}}
+{{- with .Image}}
+<img src="{{dataURI .}}" alt="">
+{{- end}}
+<pre>{{.Text}}</pre>
+{{- with .Author}}
+<p>&mdash; {{.}}</p>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// formatHandler serves the selected quote in a fixed format,
+// regardless of what the client asked for or the quote's @type
+func formatHandler(format string) http.HandlerFunc {
+	f := qotd.Formats[format]
+	f.Raw = false
+	return func(w http.ResponseWriter, r *http.Request) {
+		serveQuote(w, r, f)
+	}
+}
+
+// fail responds with an error status, formatted if f supports it
+func fail(w http.ResponseWriter, f formatter, status int, msg string) {
+	if f.WriteError == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", f.ContentType)
+	w.WriteHeader(status)
+	if err := f.WriteError(w, msg); err != nil {
+		log.Println(err)
+	}
+}
+
+// media types for the values of a quote's @type; html only
+// with -html-type, as it's served unescaped
+var quoteTypes = map[string]string{
+	"plain":    "text/plain; charset=utf-8",
+	"markdown": "text/markdown; charset=utf-8",
+	"html":     "text/html; charset=utf-8",
+}
+
+// contentType picks the content type for serving q with f: the
+// quote's own @type if f is raw, i.e. negotiated rather than
+// forced by the route, and the client explicitly accepts it, and
+// f's content type otherwise
+func contentType(r *http.Request, f formatter, q Quote) string {
+	ct, ok := quoteTypes[q.Type]
+	if q.Type == "html" && !htmlType {
+		ok = false
+	}
+	if !ok || !f.Raw {
+		return f.ContentType
+	}
+	mediaType := strings.SplitN(ct, ";", 2)[0]
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if strings.TrimSpace(strings.SplitN(part, ";", 2)[0]) == mediaType {
+			return ct
+		}
+	}
+	return f.ContentType
+}
@@ -0,0 +1,239 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatHandler(t *testing.T) {
+	loadPool(t, "@author: Someone\nA quote\n")
+	tests := []struct {
+		format      string
+		contentType string
+		body        string
+	}{
+		{"txt", "text/plain; charset=utf-8", "A quote\n\t-- Someone\n"},
+		{"json", "application/json", `{"quote":"A quote","author":"Someone"`},
+		{"html", "text/html; charset=utf-8", "<pre>A quote</pre>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			// the suffix wins over whatever the client accepts
+			for _, accept := range []string{"", "text/plain", "application/json", "text/html"} {
+				req := httptest.NewRequest("GET", "/quote."+tt.format, nil)
+				req.Header.Set("Accept", accept)
+				rec := httptest.NewRecorder()
+				formatHandler(tt.format)(rec, req)
+				if ct := rec.Header().Get("Content-Type"); rec.Code != 200 || ct != tt.contentType {
+					t.Errorf("Accept %q: got %d %s; want 200 %s", accept, rec.Code, ct, tt.contentType)
+				}
+				if !strings.Contains(rec.Body.String(), tt.body) {
+					t.Errorf("Accept %q: body %q lacks %q", accept, rec.Body, tt.body)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		handler http.HandlerFunc
+		url     string
+		status  int
+		err     string
+	}{
+		{"empty pool", "", handleQuote, "/quote", 503, "no quotes available"},
+		{"invalid maxlen", "a quote\n", handleQuote, "/quote?maxlen=x", 400, "invalid maxlen"},
+		{"too long", "a quote\n", handleQuote, "/quote?maxlen=1", 404, "no quote short enough"},
+		{"unknown author", "a quote\n", handleByAuthor, "/by/Someone", 404, "unknown author"},
+		{"unknown hash", "a quote\n", handleByHash, "/quote/by-hash/0", 404, "unknown quote hash"},
+		{"invalid count", "a quote\n", handleQuotes, "/quotes?n=x", 400, "invalid n"},
+		{"suffix", "", formatHandler("json"), "/quote.json", 503, "no quotes available"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadPool(t, tt.src)
+			for _, accept := range []string{"application/json", "text/plain"} {
+				req := httptest.NewRequest("GET", tt.url, nil)
+				req.Header.Set("Accept", accept)
+				rec := httptest.NewRecorder()
+				tt.handler(rec, req)
+				if rec.Code != tt.status {
+					t.Errorf("Accept %s: got %d; want %d", accept, rec.Code, tt.status)
+				}
+				body := strings.TrimSpace(rec.Body.String())
+				if accept == "application/json" || strings.HasSuffix(tt.url, ".json") {
+					want := `{"error":"` + tt.err + `"}`
+					if ct := rec.Header().Get("Content-Type"); ct != "application/json" || body != want {
+						t.Errorf("Accept %s: got %s %s; want application/json %s", accept, ct, body, want)
+					}
+				} else if body != "" {
+					t.Errorf("Accept %s: got body %q; want none", accept, body)
+				}
+			}
+		})
+	}
+}
+
+func TestQuoteType(t *testing.T) {
+	tests := []struct {
+		typ      string
+		path     string
+		accept   string
+		htmlType string
+		want     string
+	}{
+		{"markdown", "/quote", "text/markdown", "false", "text/markdown; charset=utf-8"},
+		{"markdown", "/quote", "text/markdown, text/plain;q=0.5", "false", "text/markdown; charset=utf-8"},
+		{"markdown", "/quote", "text/plain", "false", "text/plain; charset=utf-8"},
+		{"markdown", "/quote", "", "false", "text/plain; charset=utf-8"},
+		{"markdown", "/quote", "application/json", "false", "application/json"},
+		{"markdown", "/quote.txt", "text/markdown", "false", "text/plain; charset=utf-8"},
+		{"html", "/quote", "text/html", "false", "text/html; charset=utf-8"},
+		{"html", "/quote", "text/plain, text/html;q=0.5", "false", "text/plain; charset=utf-8"},
+		{"html", "/quote", "text/plain, text/html;q=0.5", "true", "text/html; charset=utf-8"},
+		// a browser's Accept header on a forced route
+		{"html", "/quote.txt", "text/html,application/xhtml+xml,*/*;q=0.8", "false", "text/plain; charset=utf-8"},
+		{"html", "/quote.txt", "text/html,application/xhtml+xml,*/*;q=0.8", "true", "text/plain; charset=utf-8"},
+		{"plain", "/quote", "text/plain", "false", "text/plain; charset=utf-8"},
+		{"", "/quote", "text/markdown", "false", "text/plain; charset=utf-8"},
+		{"unknown", "/quote", "text/markdown", "false", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ+" "+tt.path+" "+tt.accept+" "+tt.htmlType, func(t *testing.T) {
+			setFlag(t, "html-type", tt.htmlType)
+			src := "<script>alert(1)</script>\n"
+			if tt.typ != "" {
+				src = "@type: " + tt.typ + "\n" + src
+			}
+			loadPool(t, src)
+			handler := handleQuote
+			if tt.path == "/quote.txt" {
+				handler = formatHandler("txt")
+			}
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			ct := rec.Header().Get("Content-Type")
+			if ct != tt.want {
+				t.Errorf("Content-Type %q; want %q", ct, tt.want)
+			}
+			// unescaped markup is only ever served as text
+			if strings.HasPrefix(ct, "text/html") && strings.Contains(rec.Body.String(), "<script>") && tt.htmlType != "true" {
+				t.Errorf("served %q as %s", rec.Body, ct)
+			}
+		})
+	}
+}
+
+func TestRichJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fetched\n"))
+	}))
+	defer srv.Close()
+	withUser := strings.Replace(srv.URL, "://", "://user:secret@", 1)
+	redacted := strings.Replace(srv.URL, "://", "://user:xxxxx@", 1)
+
+	setFlag(t, "rich-json", "true")
+	files := writeSources(t, "zero\n\none\n", "two\n")
+	loadPool(t, "")
+	before := time.Now()
+	if err := reloadQuotes(context.Background(), append(files, withUser)); err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+
+	tests := []struct {
+		pin    string
+		text   string
+		source string
+	}{
+		{"0", "zero", files[0]},
+		{"1", "one", files[0]},
+		{"2", "two", files[1]},
+		{"3", "fetched", redacted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pin, func(t *testing.T) {
+			setFlag(t, "pin", tt.pin)
+			req := httptest.NewRequest("GET", "/quote", nil)
+			req.Header.Set("Accept", "application/json")
+			rec := httptest.NewRecorder()
+			handleQuote(rec, req)
+			var got struct {
+				Quote    string
+				Index    int
+				Pool     int
+				Source   string
+				Reloaded time.Time
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%v in %q", err, rec.Body)
+			}
+			if got.Quote != tt.text || strconv.Itoa(got.Index) != tt.pin || got.Pool != 4 || got.Source != tt.source {
+				t.Errorf("got %+v; want %s at %s of 4 from %s", got, tt.text, tt.pin, tt.source)
+			}
+			if got.Reloaded.Before(before) || got.Reloaded.After(after) {
+				t.Errorf("reloaded at %v; want between %v and %v", got.Reloaded, before, after)
+			}
+
+			// other formats are left alone
+			rec = httptest.NewRecorder()
+			handleQuote(rec, httptest.NewRequest("GET", "/quote", nil))
+			if rec.Body.String() != tt.text+"\n" {
+				t.Errorf("got %q as text", rec.Body)
+			}
+		})
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		want string // with DATE for the current date, or "" for a bad template
+	}{
+		{"upper and date", `{{range .}}{{upper .Text}}{{end}} on {{date "2006-01-02"}}`, "A QUOTE\nON TWO LINES on DATE"},
+		{"lower", `{{range .}}{{lower .Author}}{{end}}`, "someone"},
+		{"rand", `{{rand "only"}}`, "only"},
+		{"rand nothing", `[{{rand}}]`, "[]"},
+		{"markup", `{{range .}}{{.Text}}{{end}}<b>`, "A quote\non two lines<b>"},
+		{"unknown function", `{{shout .}}`, ""},
+		{"unparsable", `{{range .}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := writeSources(t, "@author: Someone\nA quote\non two lines\n", tt.tmpl)
+			port := freePort(t)
+			d := daemonCommand(t, "-port", port, "-template", files[1], files[0])
+			d.start(t)
+			if tt.want == "" {
+				if err := d.wait(t); err == nil {
+					t.Fatal("server started with a bad template")
+				}
+				return
+			}
+			d.await(t, "READY=1")
+			before := time.Now().Format("2006-01-02")
+			code, body := fetch(t, "http://127.0.0.1:"+port+"/quote.html")
+			after := time.Now().Format("2006-01-02")
+			if code != 200 {
+				t.Fatalf("got %d", code)
+			}
+			if body != strings.Replace(tt.want, "DATE", before, 1) && body != strings.Replace(tt.want, "DATE", after, 1) {
+				t.Errorf("rendered %q; want %q", body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// loadQuotesFromGit shallow-clones the repository of a
+// git+<url>#<path> source and loads the file at path.
+// Cloning afresh on every load picks up new commits; any
+// credentials come from git's own environment and helpers.
+func loadQuotesFromGit(ctx context.Context, source string) ([]Quote, error) {
+	repo, path := strings.TrimPrefix(source, "git+"), ""
+	if i := strings.LastIndexByte(repo, '#'); i >= 0 {
+		repo, path = repo[:i], repo[i+1:]
+	}
+	if path == "" {
+		return nil, errors.New("missing #path in git source: " + source)
+	}
+
+	dir, err := ioutil.TempDir("", "httpqotdd-git-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := exec.CommandContext(ctx, "git", "clone", "--quiet", "--depth", "1", "--", repo, dir)
+	// never wait on a password prompt
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, errors.New("git clone failed: " + strings.TrimSpace(string(out)))
+	}
+
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(path)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseQuotes(ctx, f)
+}
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	bare, work := filepath.Join(dir, "quotes.git"), filepath.Join(dir, "work")
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.org",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.org")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	commit := func(src string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(work, "dir", "quotes.txt"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("-C", work, "add", ".")
+		git("-C", work, "commit", "--quiet", "-m", "update quotes")
+		git("-C", work, "push", "--quiet", "origin", "HEAD")
+	}
+	git("init", "--quiet", "--bare", bare)
+	git("clone", "--quiet", bare, work)
+	os.Mkdir(filepath.Join(work, "dir"), 0755)
+	commit("first commit\n")
+
+	repo := "git+file://" + bare
+	tests := []struct {
+		name   string
+		source string
+		commit string // pushed before loading, if any
+		want   string // "" for an error
+	}{
+		{"clone", repo + "#dir/quotes.txt", "", "first commit"},
+		{"new commit", repo + "#dir/quotes.txt", "second commit\n", "second commit"},
+		{"missing path", repo, "", ""},
+		{"missing file", repo + "#dir/missing.txt", "", ""},
+		{"missing repo", "git+file://" + filepath.Join(dir, "missing.git") + "#quotes.txt", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.commit != "" {
+				commit(tt.commit)
+			}
+			loadPool(t, "previous\n")
+			err := reloadQuotes(context.Background(), []string{tt.source})
+			got := poolTexts()
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("loaded %q; want an error", got)
+				}
+				return
+			}
+			if err != nil || len(got) != 1 || got[0] != tt.want {
+				t.Errorf("got %v with pool %q; want %q", err, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,3 +1,16 @@
 module github.com/jktr/httpqotdd
 
-go 1.14
+go 1.19
+
+require (
+	github.com/fsnotify/fsnotify v1.6.0
+	github.com/makiuchi-d/gozxing v0.1.1
+	github.com/mattn/go-sqlite3 v1.14.16
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/text v0.3.8
+)
+
+require (
+	golang.org/x/sys v0.0.0-20220908164124-27713097b956 // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+)
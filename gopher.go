@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"time"
+)
+
+// serveGopher answers every selector on l with the selected
+// quote as a Gopher0 text item, until l is closed
+func serveGopher(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go handleGopher(conn)
+	}
+}
+
+func handleGopher(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// the selector is ignored; every item is the quote
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+		return
+	}
+	if !clientAllowed(conn.RemoteAddr().String()) {
+		return
+	}
+
+	if lazy {
+		ensureLoaded()
+	}
+
+	w := bufio.NewWriter(conn)
+	if _, selection := selectQuote(); selection != nil {
+		q := *selection
+		if sanitizeOutput {
+			q = sanitizeQuote(q)
+		}
+		for _, line := range strings.Split(q.Text, "\n") {
+			// a line of just "." would end the item early
+			if strings.HasPrefix(line, ".") {
+				line = "." + line
+			}
+			w.WriteString(line + "\r\n")
+		}
+	}
+	w.WriteString(".\r\n")
+	w.Flush()
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestGopher(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		selector string
+		want     string
+	}{
+		{"quote", "a quote\n", "\r\n", "a quote\r\n.\r\n"},
+		{"any selector", "a quote\n", "/some/selector\r\n", "a quote\r\n.\r\n"},
+		{"multiline", "first\nsecond\n", "\r\n", "first\r\nsecond\r\n.\r\n"},
+		{"dot lines", ".\n..and more\n", "\r\n", "..\r\n...and more\r\n.\r\n"},
+		{"empty pool", "", "\r\n", ".\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadPool(t, tt.src)
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			go serveGopher(l)
+
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.Write([]byte(tt.selector))
+			got, err := ioutil.ReadAll(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGopherShutdown(t *testing.T) {
+	port := freePort(t)
+	d := startDaemon(t, "-port", freePort(t), "-gopher", port, writeSources(t, "a quote\n")[0])
+	conn, err := net.Dial("tcp", "127.0.0.1:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("\r\n"))
+	if got, _ := ioutil.ReadAll(conn); string(got) != "a quote\r\n.\r\n" {
+		t.Errorf("got %q from the server", got)
+	}
+	conn.Close()
+
+	d.cmd.Process.Signal(syscall.SIGTERM)
+	if err := d.wait(t); err != nil {
+		t.Fatalf("shut down with %v", err)
+	}
+	if conn, err := net.Dial("tcp", "127.0.0.1:"+port); err == nil {
+		conn.Close()
+		t.Error("gopher still listening after shutting down")
+	}
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var imageClient = &http.Client{Timeout: 10 * time.Second}
+
+// inlineImage reads the @image at a path or URL and returns it as a
+// data URI, so that HTML output needn't link to the image source
+func inlineImage(ctx context.Context, src string) (string, error) {
+	if strings.HasPrefix(src, "data:") {
+		// e.g. written back by a snapshot
+		if len(src) > base64.StdEncoding.EncodedLen(maxImage)+64 {
+			return "", fmt.Errorf("image larger than %d bytes", maxImage)
+		}
+		// the HTML template trusts these, so they must be images
+		mt := strings.TrimPrefix(src, "data:")
+		if i := strings.IndexAny(mt, ";,"); i >= 0 {
+			mt = mt[:i]
+		}
+		if !strings.HasPrefix(strings.ToLower(mt), "image/") {
+			return "", fmt.Errorf("data URI is not an image but %s", mt)
+		}
+		return src, nil
+	}
+
+	var r io.ReadCloser
+	if strings.HasPrefix(src, "https://") || strings.HasPrefix(src, "http://") {
+		req, err := newFetchRequest(ctx, src)
+		if err != nil {
+			return "", err
+		}
+		resp, err := imageClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return "", fmt.Errorf("failed fetching image %s: %d", src, resp.StatusCode)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(src)
+		if err != nil {
+			return "", err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(maxImage)+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxImage {
+		return "", fmt.Errorf("image %s larger than %d bytes", src, maxImage)
+	}
+	ct := http.DetectContentType(data)
+	if !strings.HasPrefix(ct, "image/") {
+		return "", fmt.Errorf("%s is not an image but %s", src, ct)
+	}
+	return "data:" + ct + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestInlineImage(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "image.png")
+	text := filepath.Join(dir, "image.txt")
+	ioutil.WriteFile(image, pngHeader, 0644)
+	ioutil.WriteFile(text, []byte("not an image"), 0644)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pngHeader)
+	}))
+	defer srv.Close()
+
+	uri := "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngHeader)
+	tests := []struct {
+		src  string
+		want string // "" if the image is refused
+	}{
+		{image, uri},
+		{srv.URL + "/image.png", uri},
+		{uri, uri},
+		{"data:IMAGE/PNG;base64,AAAA", "data:IMAGE/PNG;base64,AAAA"},
+		{text, ""},
+		{filepath.Join(dir, "missing.png"), ""},
+		{"data:text/html,<script>alert(1)</script>", ""},
+		{"data:,plain", ""},
+	}
+	for _, tt := range tests {
+		got, err := inlineImage(context.Background(), tt.src)
+		if tt.want == "" && err == nil {
+			t.Errorf("inlineImage(%q) = %q; want an error", tt.src, got)
+		} else if tt.want != "" && (err != nil || got != tt.want) {
+			t.Errorf("inlineImage(%q) = %q, %v; want %q", tt.src, got, err, tt.want)
+		}
+	}
+}
+
+func TestInlineImageTooLarge(t *testing.T) {
+	setFlag(t, "max-image", "16")
+	file := filepath.Join(t.TempDir(), "image.png")
+	ioutil.WriteFile(file, append(pngHeader, bytes.Repeat([]byte{0}, 16)...), 0644)
+	if _, err := inlineImage(context.Background(), file); err == nil {
+		t.Error("inlined an image larger than -max-image")
+	}
+}
+
+func TestInlineImageCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := inlineImage(ctx, srv.URL); err == nil {
+		t.Error("fetched an image after the reload was cancelled")
+	}
+}
+
+func TestHTMLImage(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "image.png")
+	ioutil.WriteFile(file, pngHeader, 0644)
+	loadPool(t, "@author: Someone\n@image: "+file+"\nA quote with a picture\n")
+
+	rec := httptest.NewRecorder()
+	formatHandler("html")(rec, httptest.NewRequest("GET", "/quote.html", nil))
+	body := rec.Body.String()
+	uri := "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngHeader)
+	if !strings.Contains(body, `<img src="`+uri+`"`) {
+		t.Errorf("HTML quote lacks the inlined image:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	formatHandler("txt")(rec, httptest.NewRequest("GET", "/quote.txt", nil))
+	if strings.Contains(rec.Body.String(), "data:") {
+		t.Errorf("text quote includes the image:\n%s", rec.Body)
+	}
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// langSourceList is a repeatable flag of lang:source pairs
+type langSourceList struct {
+	tags    []language.Tag
+	sources []string
+	matcher language.Matcher
+}
+
+func (l *langSourceList) String() string {
+	if l == nil {
+		return ""
+	}
+	s := make([]string, len(l.sources))
+	for i := range l.sources {
+		s[i] = l.tags[i].String() + ":" + l.sources[i]
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *langSourceList) Set(value string) error {
+	i := strings.Index(value, ":")
+	if i < 0 {
+		return fmt.Errorf("expected lang:source, got %q", value)
+	}
+	tag, err := language.Parse(value[:i])
+	if err != nil {
+		return err
+	}
+	l.tags = append(l.tags, tag)
+	l.sources = append(l.sources, value[i+1:])
+
+	// the undetermined language stands for the default pool
+	l.matcher = language.NewMatcher(append([]language.Tag{language.Und}, l.tags...))
+	return nil
+}
+
+// per-language pools, parallel to sourceLangs; guarded by quotesM
+var langQuotes [][]Quote
+
+// loadLangSources loads the quotes of each -source-lang source
+func loadLangSources(ctx context.Context) ([][]Quote, error) {
+	pools := make([][]Quote, len(sourceLangs.sources))
+	for i, source := range sourceLangs.sources {
+		qs, err := fetchQuotes(ctx, source)
+		if err != nil && err != errUnchanged {
+			return nil, err
+		}
+		if dedup {
+			qs = dedupQuotes(qs)
+		}
+		if include != nil {
+			qs = matchingQuotes(qs, include, true)
+		}
+		if exclude != nil {
+			qs = matchingQuotes(qs, exclude, false)
+		}
+		pools[i] = qs
+	}
+	return pools, nil
+}
+
+// langQuote picks a random quote from the pool best matching the
+// request's Accept-Language, returning its index and the size of
+// that pool, or returns nil to fall back to the default pool. The
+// -pin, -calendar and -cache quotes come from the default pool
+// whatever the language.
+func langQuote(r *http.Request) (int, int, *Quote) {
+	if sourceLangs.matcher == nil {
+		return -1, 0, nil
+	}
+	accept := r.Header.Get("Accept-Language")
+	if accept == "" {
+		return -1, 0, nil
+	}
+	if pin >= 0 || cache > 0 && !wantsFresh(r) {
+		return -1, 0, nil
+	}
+	if _, q := calendarQuote(pool.Snapshot(), time.Now()); q != nil {
+		return -1, 0, nil
+	}
+	_, i := language.MatchStrings(sourceLangs.matcher, accept)
+	if i == 0 {
+		return -1, 0, nil
+	}
+
+	quotesM.RLock()
+	defer quotesM.RUnlock()
+
+	if i > len(langQuotes) || len(langQuotes[i-1]) == 0 {
+		return -1, 0, nil
+	}
+	qs := langQuotes[i-1]
+	idx := rand.Intn(len(qs))
+	return idx, len(qs), &qs[idx]
+}
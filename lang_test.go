@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLangSourceList(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"en:quotes.txt", true},
+		{"de-CH:https://example.org/quotes.txt", true},
+		{"quotes.txt", false},
+		{":quotes.txt", false},
+		{"not a tag:quotes.txt", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var l langSourceList
+			if err := l.Set(tt.value); (err == nil) != tt.ok {
+				t.Errorf("got %v; want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLangQuote(t *testing.T) {
+	saved := sourceLangs
+	t.Cleanup(func() {
+		sourceLangs = saved
+		quotesM.Lock()
+		langQuotes = nil
+		quotesM.Unlock()
+	})
+	sourceLangs = langSourceList{}
+	files := writeSources(t, "english\n", "deutsch\n")
+	for _, v := range []string{"en:" + files[0], "de:" + files[1]} {
+		if err := sourceLangs.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loadPool(t, "default\n")
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"en", "english\n"},
+		{"en-GB", "english\n"},
+		{"de-CH, de;q=0.9", "deutsch\n"},
+		{"fr, de;q=0.5", "deutsch\n"},
+		{"de;q=0.5, en", "english\n"},
+		{"fr", "default\n"},
+		{"", "default\n"},
+		{"*", "default\n"},
+		{"not a tag", "default\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/quote", nil)
+			req.Header.Set("Accept-Language", tt.accept)
+			rec := httptest.NewRecorder()
+			handleQuote(rec, req)
+			if rec.Body.String() != tt.want {
+				t.Errorf("got %q; want %q", rec.Body, tt.want)
+			}
+			if v := rec.Header().Get("Vary"); v != "Accept-Language" {
+				t.Errorf("Vary %q; want Accept-Language", v)
+			}
+		})
+	}
+}
+
+func TestLangQuoteSelection(t *testing.T) {
+	saved := sourceLangs
+	t.Cleanup(func() {
+		sourceLangs = saved
+		quotesM.Lock()
+		langQuotes = nil
+		quotesM.Unlock()
+	})
+	sourceLangs = langSourceList{}
+	if err := sourceLangs.Set("de:" + writeSources(t, "eins\n\nzwei\n\ndrei\n")[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		flags map[string]string
+		query string
+		want  []string // any of these, for German requests
+		count string
+	}{
+		{"random", nil, "", []string{"eins\n", "zwei\n", "drei\n"}, "3"},
+		{"numbered", map[string]string{"number": "true"}, "", []string{"[0/3] eins\n", "[1/3] zwei\n", "[2/3] drei\n"}, "3"},
+		{"pin", map[string]string{"pin": "0", "number": "true"}, "", []string{"[0/1] default\n"}, "1"},
+		{"cache", map[string]string{"cache": "1h"}, "", []string{"default\n"}, "1"},
+		{"cache fresh", map[string]string{"cache": "1h"}, "?fresh=1", []string{"eins\n", "zwei\n", "drei\n"}, "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.flags {
+				setFlag(t, name, value)
+			}
+			loadPool(t, "default\n")
+			for i := 0; i < 20; i++ {
+				req := httptest.NewRequest("GET", "/quote"+tt.query, nil)
+				req.Header.Set("Accept-Language", "de")
+				rec := httptest.NewRecorder()
+				handleQuote(rec, req)
+				if !strings.Contains("|"+strings.Join(tt.want, "|")+"|", "|"+rec.Body.String()+"|") {
+					t.Fatalf("got %q; want one of %q", rec.Body, tt.want)
+				}
+				if n := rec.Header().Get("X-Quote-Count"); n != tt.count {
+					t.Errorf("X-Quote-Count %s; want %s", n, tt.count)
+				}
+			}
+		})
+	}
+
+	t.Run("calendar", func(t *testing.T) {
+		saved := calendar
+		t.Cleanup(func() { calendar = saved })
+		today := time.Now().Format("2006-01-02")
+		var err error
+		if calendar, err = parseCalendar(today + ":" + today); err != nil {
+			t.Fatal(err)
+		}
+		loadPool(t, "default\n")
+		req := httptest.NewRequest("GET", "/quote", nil)
+		req.Header.Set("Accept-Language", "de")
+		rec := httptest.NewRecorder()
+		handleQuote(rec, req)
+		if rec.Body.String() != "default\n" {
+			t.Errorf("got %q; want the calendar quote", rec.Body)
+		}
+	})
+
+	t.Run("rich json", func(t *testing.T) {
+		setFlag(t, "rich-json", "true")
+		loadPool(t, "default\n")
+		req := httptest.NewRequest("GET", "/quote.json", nil)
+		req.Header.Set("Accept-Language", "de")
+		rec := httptest.NewRecorder()
+		formatHandler("json")(rec, req)
+		if !strings.Contains(rec.Body.String(), `"pool":3`) {
+			t.Errorf("got %q; want the German pool of 3", rec.Body)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// set once any load has succeeded
+	loaded int32
+	lazyM  sync.Mutex
+)
+
+// ensureLoaded performs the initial load in -lazy mode, blocking
+// concurrent callers until it's done; failed loads are retried
+// by the next caller
+func ensureLoaded() {
+	if atomic.LoadInt32(&loaded) == 1 {
+		return
+	}
+	lazyM.Lock()
+	defer lazyM.Unlock()
+	if atomic.LoadInt32(&loaded) == 0 {
+		<-requestReload()
+	}
+}
+
+func lazyLoad(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ensureLoaded()
+		next.ServeHTTP(w, r)
+	})
+}
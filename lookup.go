@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jktr/httpqotdd/qotd"
+)
+
+// handleAuthors lists the distinct authors in the pool, one per line
+func handleAuthors(w http.ResponseWriter, r *http.Request) {
+	seen := map[string]bool{}
+	for _, q := range pool.Quotes() {
+		author := q.Author
+		if sanitizeOutput {
+			// before deduplicating, as authors may only
+			// differ in what's stripped
+			author = sanitize(author)
+		}
+		if author != "" {
+			seen[author] = true
+		}
+	}
+
+	authors := make([]string, 0, len(seen))
+	for author := range seen {
+		authors = append(authors, author)
+	}
+	sort.Strings(authors)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, author := range authors {
+		fmt.Fprintln(w, author)
+	}
+}
+
+// handleByHash serves the quote with the content hash given in the path
+func handleByHash(w http.ResponseWriter, r *http.Request) {
+	f := qotd.Negotiate(r)
+	hash := strings.TrimPrefix(r.URL.Path, "/quote/by-hash/")
+	idx, selection := selectQuoteWhere(func(q *Quote) bool {
+		return q.Hash == hash
+	})
+	if selection == nil {
+		fail(w, f, 404, "unknown quote hash")
+		return
+	}
+	writeQuote(w, r, f, idx, poolSize(), selection, false)
+}
+
+// handleByAuthor serves a random quote by the author named in the path
+func handleByAuthor(w http.ResponseWriter, r *http.Request) {
+	f := qotd.Negotiate(r)
+	author := strings.TrimPrefix(r.URL.Path, "/by/")
+	idx, selection := selectQuoteWhere(func(q *Quote) bool {
+		return q.Author != "" && q.Author == author
+	})
+	if selection == nil {
+		fail(w, f, 404, "unknown author")
+		return
+	}
+	writeQuote(w, r, f, idx, poolSize(), selection, false)
+}
+
+// handleByCategory serves a random quote from the category in the path
+func handleByCategory(w http.ResponseWriter, r *http.Request) {
+	f := qotd.Negotiate(r)
+	category := strings.TrimPrefix(r.URL.Path, "/c/")
+	idx, selection := selectQuoteWhere(func(q *Quote) bool {
+		return q.Category != "" && q.Category == category
+	})
+	if selection == nil {
+		fail(w, f, 404, "unknown category")
+		return
+	}
+	writeQuote(w, r, f, idx, poolSize(), selection, false)
+}
+
+// handleQuotes serves ?n= distinct random quotes at once
+func handleQuotes(w http.ResponseWriter, r *http.Request) {
+	f := qotd.Negotiate(r)
+	n := 1
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			fail(w, f, 400, "invalid n")
+			return
+		}
+	}
+
+	qs := sampleQuotes(n)
+	if len(qs) == 0 && n > 0 {
+		fail(w, f, emptyStatus, "no quotes available")
+		return
+	}
+	if sanitizeOutput {
+		for i := range qs {
+			qs[i] = sanitizeQuote(qs[i])
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", f.ContentType)
+	if err := f.WriteList(w, qs); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,216 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jktr/httpqotdd/qotd"
+)
+
+const authoredQuotes = "@author: Jane Doe\nfirst by Jane\n\n" +
+	"@author: John\nby John\n\n" +
+	"@author: Jane Doe\nsecond by Jane\n\n" +
+	"by nobody\n"
+
+func TestAuthors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"authors", authoredQuotes, "Jane Doe\nJohn\n"},
+		{"none", "by nobody\n", ""},
+		{"empty pool", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadPool(t, tt.src)
+			rec := httptest.NewRecorder()
+			handleAuthors(rec, httptest.NewRequest("GET", "/authors", nil))
+			if rec.Code != 200 || rec.Body.String() != tt.want {
+				t.Errorf("got %d %q; want 200 %q", rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestByAuthor(t *testing.T) {
+	loadPool(t, authoredQuotes)
+	tests := []struct {
+		path string
+		want []string // any of these, or a 404 if none
+	}{
+		{"/by/John", []string{"by John\n\t-- John\n"}},
+		{"/by/Jane%20Doe", []string{"first by Jane\n\t-- Jane Doe\n", "second by Jane\n\t-- Jane Doe\n"}},
+		{"/by/Jane", nil},
+		// not the quotes without an author
+		{"/by/", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			// every quote by the author comes up eventually
+			seen := map[string]bool{}
+			for i := 0; i < 100; i++ {
+				rec := httptest.NewRecorder()
+				handleByAuthor(rec, httptest.NewRequest("GET", tt.path, nil))
+				if tt.want == nil {
+					if rec.Code != 404 {
+						t.Fatalf("got %d; want 404", rec.Code)
+					}
+					return
+				}
+				if rec.Code != 200 {
+					t.Fatalf("got %d; want 200", rec.Code)
+				}
+				seen[rec.Body.String()] = true
+			}
+			if len(seen) != len(tt.want) {
+				t.Errorf("served %v; want %q", seen, tt.want)
+			}
+			for _, want := range tt.want {
+				if !seen[want] {
+					t.Errorf("never served %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestByHash(t *testing.T) {
+	loadPool(t, "first\n\nsecond\n")
+	hash := qotd.Hash("second")
+	if len(hash) != 8 {
+		t.Fatalf("hash %q isn't 8 hex digits", hash)
+	}
+	tests := []struct {
+		hash   string
+		status int
+		body   string
+	}{
+		{hash, 200, "second\n"},
+		{qotd.Hash("first"), 200, "first\n"},
+		{qotd.Hash("missing"), 404, ""},
+		{"", 404, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handleByHash(rec, httptest.NewRequest("GET", "/quote/by-hash/"+tt.hash, nil))
+		if rec.Code != tt.status || rec.Body.String() != tt.body {
+			t.Errorf("%q: got %d %q; want %d %q", tt.hash, rec.Code, rec.Body, tt.status, tt.body)
+		}
+	}
+
+	// the hash stays with the quote as indices change
+	loadPool(t, "new\n\nsecond\n\nfirst\n")
+	rec := httptest.NewRecorder()
+	handleByHash(rec, httptest.NewRequest("GET", "/quote/by-hash/"+hash, nil))
+	if rec.Body.String() != "second\n" {
+		t.Errorf("after reloading got %q; want the same quote", rec.Body)
+	}
+}
+
+func TestQuotes(t *testing.T) {
+	const src = "one\n\ntwo\n\nthree\n\nfour\n\nfive\n"
+	tests := []struct {
+		query string
+		src   string
+		code  int
+		want  int // quotes in the response
+	}{
+		{"", src, 200, 1},
+		{"?n=0", src, 200, 0},
+		{"?n=3", src, 200, 3},
+		{"?n=5", src, 200, 5},
+		{"?n=10", src, 200, 5},
+		{"?n=-1", src, 400, 0},
+		{"?n=many", src, 400, 0},
+		{"?n=3", "", 503, 0},
+	}
+	for _, tt := range tests {
+		for _, accept := range []string{"text/plain", "application/json"} {
+			t.Run(tt.query+" "+accept, func(t *testing.T) {
+				loadPool(t, tt.src)
+				req := httptest.NewRequest("GET", "/quotes"+tt.query, nil)
+				req.Header.Set("Accept", accept)
+				rec := httptest.NewRecorder()
+				handleQuotes(rec, req)
+				if rec.Code != tt.code {
+					t.Fatalf("got %d; want %d", rec.Code, tt.code)
+				}
+				if tt.code != 200 {
+					return
+				}
+
+				var got []string
+				if accept == "application/json" {
+					var qs []qotd.Quote
+					if err := json.Unmarshal(rec.Body.Bytes(), &qs); err != nil {
+						t.Fatalf("%v in %q", err, rec.Body)
+					}
+					for _, q := range qs {
+						got = append(got, q.Text)
+					}
+				} else if rec.Body.Len() > 0 {
+					got = strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n\n")
+				}
+				if len(got) != tt.want {
+					t.Fatalf("got %d quotes %q; want %d", len(got), got, tt.want)
+				}
+				seen := map[string]bool{}
+				for _, q := range got {
+					if q == "" || seen[q] || !strings.Contains(src, q+"\n") {
+						t.Errorf("got %q; want distinct quotes from the pool", got)
+					}
+					seen[q] = true
+				}
+			})
+		}
+	}
+}
+
+func TestByCategory(t *testing.T) {
+	setFlag(t, "categories", "true")
+	loadPool(t, "uncategorized\n\n[wisdom]\nfirst wise\n\nsecond wise\n\n[jokes]\na joke\n")
+	tests := []struct {
+		path string
+		want []string // any of these, or a 404 if none
+	}{
+		{"/c/jokes", []string{"a joke\n"}},
+		{"/c/wisdom", []string{"first wise\n", "second wise\n"}},
+		{"/c/unknown", nil},
+		{"/c/Jokes", nil},
+		// not the quotes without a category
+		{"/c/", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			seen := map[string]bool{}
+			for i := 0; i < 100; i++ {
+				rec := httptest.NewRecorder()
+				handleByCategory(rec, httptest.NewRequest("GET", tt.path, nil))
+				if tt.want == nil {
+					if rec.Code != 404 {
+						t.Fatalf("got %d; want 404", rec.Code)
+					}
+					return
+				}
+				if rec.Code != 200 {
+					t.Fatalf("got %d; want 200", rec.Code)
+				}
+				seen[rec.Body.String()] = true
+			}
+			for _, q := range tt.want {
+				if !seen[q] {
+					t.Errorf("never served %q; got %v", q, seen)
+				}
+			}
+			if len(seen) != len(tt.want) {
+				t.Errorf("served %v; want only %q", seen, tt.want)
+			}
+		})
+	}
+}
@@ -4,243 +4,1415 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/csv"
 	"errors"
 	"flag"
 	"fmt"
+	"html/template"
 	"io"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode/utf8"
+
+	"github.com/jktr/httpqotdd/qotd"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
 )
 
 var (
-	addr    string
-	port    string
-	reload  time.Duration
-	cache   time.Duration
-	verbose bool
-
-	quote   *string
-	quotes  *[]string
-	quotesM sync.RWMutex
+	addr              string
+	port              string
+	gopher            string
+	reload            time.Duration
+	backoff           time.Duration
+	reloadMinInterval time.Duration
+	watch             bool
+	hupRestart        bool
+	delay             time.Duration
+	cron              *cronSchedule
+	calendar          *calendarRange
+	cache             time.Duration
+	reselectOnReload  bool
+	sample            int
+	recentWindow      int
+	maxReloads        int
+	lazy              bool
+	mmapIndex         bool
+	readyDelay        time.Duration
+	healthTimeout     time.Duration
+	shutdownDrain     time.Duration
+	pin               int
+	format            string
+
+	sourceCharset   encoding.Encoding
+	outputCharset   encoding.Encoding
+	outputName      string // MIME name of outputCharset
+	maxLine         int
+	maxQuote        int
+	maxImage        int
+	commentsBetween bool
+	blankLines      int
+	categories      bool
+	escape          bool
+	strict          bool
+	bias            string
+	trim            bool
+	dedup           bool
+	include         *regexp.Regexp
+	exclude         *regexp.Regexp
+	wrap            int
+	number          bool
+	verbose         bool
+
+	acceptSubmissions  bool
+	previewLen         int
+	logSample          float64
+	statusReason       bool
+	indexTrailer       bool
+	richJSON           bool
+	enablePprof        bool
+	enableDistribution bool
+	enableUI           bool
+	sanitizeOutput     bool
+	htmlType           bool
+	noRoot             bool
+	emptyStatus        int
+	empty204           bool
+	snapshotDir        string
+
+	streamInterval time.Duration
+	streamMax      int
+
+	useSessions bool
+	buckets     int
+	bucketKey   string
+	sessionMax  int
+	sessionIdle time.Duration
+
+	fallbacks      stringList
+	sourceLangs    langSourceList
+	loadedFallback string // fallback the pool was last loaded from, if any
+	skipUnchanged  bool
+	respectCache   bool
+	dropFailed     bool
+	staging        string
+	keepLastGood   bool
+	fetchUserAgent string
+	webhook        string
+	maxPages       int
+	fifoTimeout    time.Duration
+	filterCmd      string
+	filterTimeout  time.Duration
+
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	fetchConcurrency int
+
+	allowCIDR cidrList
+	denyCIDR  cidrList
+
+	// the pool, read without locking, and the cached quote
+	// pointing into it; quotesM guards the latter and the
+	// timestamps below, and serializes replacing the pool.
+	// Pool snapshots are never modified, so a *Quote stays
+	// valid after unlocking.
+	pool     = qotd.Pool{Weigh: biasWeights}
+	quote    *Quote
+	quoteIdx int
+	quotesM  sync.RWMutex
+
+	// time of the last cache ticker reselection; reloads also
+	// reselect unless -reselect-on-reload=false, but don't move
+	// when the cached quote expires
+	cachedAt time.Time
+
+	// time the pool was last replaced by a reload
+	reloadedAt time.Time
+)
+
+// flags only looked at while parsing the others
+var (
+	cronSpec       *string
+	calendarSpec   *string
+	first          *bool
+	charset        *string
+	templateFile   *string
+	outCharset     *string
+	includeRe      *string
+	excludeRe      *string
+	toSyslog       *bool
+	syslogFacility *string
+	syslogTag      *string
 )
 
 func init() {
 	flag.Usage = func() {
-		fmt.Printf("Usage: %s [OPTIONS] (FILE|URL)\n", os.Args[0])
+		fmt.Printf("Usage: %s [OPTIONS] (FILE|URL)...\n", os.Args[0])
 		flag.PrintDefaults()
 	}
-	flag.StringVar(&port, "port", "8080", "bind to `port`")
-	flag.StringVar(&addr, "addr", "[::1]", "bind to `address`")
+	flag.StringVar(&port, "port", "8080", "bind to `port` (comma-separated for several)")
+	flag.StringVar(&addr, "addr", "[::1]", "bind to `address` (comma-separated for several)")
+	flag.StringVar(&gopher, "gopher", "", "also serve quotes over gopher on `port`")
 	flag.DurationVar(&reload, "reload", 0, "quote source refresh `interval` (0 = no refresh; default 0)")
+	flag.BoolVar(&hupRestart, "hup-restart", false, "on SIGHUP, restart the server in place, handing over its sockets, instead of reloading")
+	flag.BoolVar(&watch, "watch", false, "reload when a file source changes")
+	flag.IntVar(&maxReloads, "max-reloads", 0, "exit after `n` successful reloads (0 = never; default 0)")
+	flag.DurationVar(&reloadMinInterval, "reload-min-interval", 0, "defer reloads until `duration` after the previous one (0 = don't limit; default 0)")
+	flag.DurationVar(&backoff, "reload-backoff", 0, "double the refresh interval after each failed reload, up to `max` (0 = no backoff; default 0)")
+	cronSpec = flag.String("reload-cron", "", "quote source refresh `schedule` as a cron expression, e.g. \"0 0 * * *\"")
+	flag.Var(&sourceLangs, "source-lang", "`lang:source` to serve to clients preferring that language (repeatable; others get the default sources)")
+	flag.Var(&fallbacks, "fallback", "quote `source` to load if the others fail (repeatable; tried in order)")
+	flag.BoolVar(&keepLastGood, "keep-last-good", false, "keep serving the previous pool when a reload yields no quotes, counting the reload as failed")
+	flag.StringVar(&staging, "staging", "", "on reload, load `file` and, if it has quotes, rename it over the first source")
+	flag.BoolVar(&dropFailed, "drop-failed-sources", false, "leave out the quotes of failing sources until they recover, rather than failing the reload")
+	flag.BoolVar(&respectCache, "respect-cache-headers", false, "don't refetch URL sources until their Cache-Control max-age has passed")
+	flag.BoolVar(&skipUnchanged, "skip-unchanged", false, "skip reloads when no source changed (by file mtime/size or HTTP ETag/Last-Modified)")
+	flag.StringVar(&webhook, "webhook", "", "POST each newly selected quote as JSON to `url`, on reloads and -cache reselections")
+	flag.IntVar(&fetchConcurrency, "fetch-concurrency", 4, "load up to `n` sources at a time")
+	flag.StringVar(&fetchUserAgent, "fetch-user-agent", "", "`user-agent` sent when fetching URL sources")
+	flag.StringVar(&filterCmd, "filter-cmd", "", "shell `command` to pipe each quote through when loading, e.g. cowsay")
+	flag.DurationVar(&filterTimeout, "filter-timeout", 5*time.Second, "`duration` after which -filter-cmd is killed and its quote skipped")
+	flag.DurationVar(&fifoTimeout, "fifo-timeout", 5*time.Second, "`duration` to wait for a named pipe source's writer to finish")
+	flag.IntVar(&maxPages, "max-pages", 1, "follow Link rel=\"next\" headers of URL sources for up to `n` pages")
+	flag.IntVar(&breakerThreshold, "breaker-threshold", 0, "stop fetching a URL source after `n` consecutive failures (0 = never; default 0)")
+	flag.DurationVar(&breakerCooldown, "breaker-cooldown", 5*time.Minute, "`duration` to pause fetches once -breaker-threshold is reached")
 	flag.DurationVar(&cache, "cache", 0, "`duration` to cache selected quote (0 = don't cache; default 0)")
+	flag.BoolVar(&reselectOnReload, "reselect-on-reload", true, "reselect the -cache quote on each reload; if false, keep it until the cache expires unless the reload dropped it")
+	flag.IntVar(&recentWindow, "recent-window", 0, "avoid serving any of the last `k` quotes served again (0 = allow repeats; default 0)")
+	calendarSpec = flag.String("calendar", "", "serve a fixed quote each day from `start:end` dates, e.g. 2026-12-01:2026-12-24; the first day gets quote 0")
+	flag.IntVar(&pin, "pin", -1, "always serve the quote at `index` (-1 = don't pin; default -1)")
+	first = flag.Bool("first", false, "always serve the first quote of the pool, same as -pin 0")
+	flag.BoolVar(&lazy, "lazy", false, "defer loading quotes until the first request")
+	flag.BoolVar(&mmapIndex, "mmap", false, "map the quote file into memory and parse quotes from it as they're served, for pools too large to hold")
+	flag.DurationVar(&healthTimeout, "health-timeout", 2*time.Second, "`duration` after which /health?deep=1 gives up and answers 503")
+	flag.DurationVar(&shutdownDrain, "shutdown-drain", 0, "on shutdown, keep serving for `duration` with /health failing, so load balancers can stop sending traffic first (default 0)")
+	flag.DurationVar(&readyDelay, "ready-delay", 0, "keep /readyz failing for `duration` after the initial load (default 0)")
+	flag.IntVar(&sample, "sample", 0, "keep a random sample of at most `n` quotes (0 = keep all; default 0)")
+	flag.StringVar(&format, "format", "plain", "quote source `format`: plain or csv")
+	charset = flag.String("source-charset", "", "decode quote sources from `charset`, e.g. iso-8859-1 (default: read as UTF-8)")
+	templateFile = flag.String("template", "", "render HTML quotes with the html/template in `file`, given the list of quotes to show")
+	outCharset = flag.String("output-charset", "", "serve text quotes encoded in `charset`, replacing characters it lacks (default: UTF-8)")
+	flag.StringVar(&bias, "bias", "none", "favour `length` when selecting quotes: none, short or long")
+	flag.IntVar(&maxLine, "max-line", bufio.MaxScanTokenSize, "maximum source line length in `bytes`")
+	flag.BoolVar(&strict, "strict", false, "fail loading on empty, invalid UTF-8 or overlong quotes instead of skipping them")
+	flag.BoolVar(&categories, "categories", false, "read \"[name]\" lines between quotes as headers of category sections, served on /c/name")
+	flag.IntVar(&blankLines, "blank-lines", 1, "number of consecutive blank `lines` separating quotes; fewer are part of the quote")
+	flag.BoolVar(&escape, "escape", true, "read a leading \\# as a literal # and a lone \\ as an empty line; disable for sources with literal backslashes")
+	flag.BoolVar(&commentsBetween, "comments-only-between-quotes", false, "treat # lines inside a quote as quote text, e.g. for ASCII art")
+	flag.IntVar(&maxImage, "max-image", 32<<10, "maximum size of a quote's @image in `bytes`")
+	flag.IntVar(&maxQuote, "max-quote", 0, "maximum quote length in `bytes` (0 = unlimited; default 0)")
+	flag.BoolVar(&trim, "trim", false, "trim leading/trailing whitespace from each quote")
+	includeRe = flag.String("include", "", "keep only quotes matching `regexp`, before applying -exclude")
+	excludeRe = flag.String("exclude", "", "drop quotes matching `regexp`")
+	flag.BoolVar(&dedup, "dedup", false, "drop duplicate quotes across all sources")
+	flag.IntVar(&emptyStatus, "empty-status", 503, "HTTP `status` to answer quote requests with while the pool is empty")
+	flag.BoolVar(&empty204, "empty-204", false, "keep empty quotes when loading and answer 204 No Content when one is selected")
+	flag.BoolVar(&noRoot, "no-root", false, "only serve quotes on /quote, not on /")
+	flag.BoolVar(&acceptSubmissions, "accept-submissions", false, "add quotes POSTed to / to the pool until the next reload")
+	flag.BoolVar(&sanitizeOutput, "sanitize", false, "strip control characters other than newline and tab from served quotes")
+	flag.BoolVar(&htmlType, "html-type", false, "let quotes with @type: html be served as HTML; only for sources whose markup you trust")
+	flag.DurationVar(&delay, "delay", 0, "`duration` to wait before answering quote requests (0 = no delay; default 0)")
+	flag.BoolVar(&number, "number", false, "prefix served quotes with their index and the pool size, e.g. \"[42/200] \"")
+	flag.IntVar(&wrap, "wrap", 0, "word-wrap served quotes at `columns` (0 = don't wrap; default 0)")
+	flag.DurationVar(&streamInterval, "stream-interval", time.Minute, "`interval` between quotes pushed on /stream")
+	flag.IntVar(&streamMax, "stream-clients", 64, "maximum concurrent /stream `clients` (0 = unlimited)")
+	flag.BoolVar(&useSessions, "sessions", false, "serve each client session every quote once before repeating any (per cookie)")
+	flag.IntVar(&buckets, "buckets", 0, "split quotes into `n` buckets by hash and serve each client from one, e.g. for A/B tests (0 = don't; default 0)")
+	flag.StringVar(&bucketKey, "bucket-key", "", "assign clients to -buckets by `cookie:name` or `header:name`, falling back to the client address (default: client address)")
+	flag.IntVar(&sessionMax, "session-max", 10000, "maximum number of client `sessions` to track")
+	flag.DurationVar(&sessionIdle, "session-idle", time.Hour, "forget client sessions idle for `duration`")
+	flag.Var(&allowCIDR, "allow-cidr", "only serve quotes to clients in `cidr` (repeatable; takes precedence over -deny-cidr)")
+	flag.Var(&denyCIDR, "deny-cidr", "refuse to serve quotes to clients in `cidr` (repeatable)")
+	flag.IntVar(&previewLen, "log-preview", 40, "truncate quotes shown in verbose logs to `length` characters")
+	flag.StringVar(&snapshotDir, "snapshot-dir", "", "write the quote pool to a file in `directory` on SIGUSR1")
+	flag.Float64Var(&logSample, "log-sample", 1, "fraction of requests to access log in verbose mode, from 0 to 1")
+	flag.BoolVar(&statusReason, "status-reason", false, "put the quote index in the HTTP/1.x status reason phrase, e.g. \"200 Quote-42\"")
+	flag.BoolVar(&enableUI, "ui", false, "serve a small web page for browsing quotes on /ui")
+	flag.BoolVar(&enablePprof, "pprof", false, "expose profiling data on /debug/pprof/")
+	flag.BoolVar(&enableDistribution, "debug-distribution", false, "expose quote selection frequencies on /debug/distribution")
+	flag.BoolVar(&richJSON, "rich-json", false, "include the index, pool size, source and reload time in JSON quotes")
+	flag.BoolVar(&indexTrailer, "index-trailer", false, "send the quote index in an X-Quote-Index HTTP trailer")
 	flag.BoolVar(&verbose, "verbose", false, "verbose output: reloads / cache selections / access logs")
+	toSyslog = flag.Bool("syslog", false, "log to the local syslog instead of stderr")
+	syslogFacility = flag.String("syslog-facility", "daemon", "syslog `facility` to log as, e.g. daemon or local0")
+	syslogTag = flag.String("syslog-tag", "httpqotdd", "`tag` syslog messages with")
+}
+
+// parseFlags parses the command line and checks the flags
+func parseFlags() {
 	flag.Parse()
-	if flag.NArg() != 1 {
+	if *toSyslog {
+		if err := useSyslog(*syslogFacility, *syslogTag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if flag.NArg() < 1 {
 		flag.Usage()
 		log.Fatal("missing quote source")
 	}
+	if first := flag.Arg(0); staging != "" && (strings.Contains(first, "://") || strings.HasPrefix(first, "git+")) {
+		log.Fatal("-staging needs the first source to be a file")
+	}
+	if format != "plain" && format != "csv" {
+		log.Fatal("unknown quote source format: " + format)
+	}
+	if *charset != "" {
+		var err error
+		sourceCharset, err = ianaindex.IANA.Encoding(*charset)
+		if err != nil || sourceCharset == nil {
+			log.Fatal("unsupported source charset: " + *charset)
+		}
+	}
+	if *outCharset != "" {
+		var err error
+		outputCharset, err = ianaindex.IANA.Encoding(*outCharset)
+		if err != nil || outputCharset == nil {
+			log.Fatal("unsupported output charset: " + *outCharset)
+		}
+		if outputName, err = ianaindex.MIME.Name(outputCharset); err != nil {
+			outputName, _ = ianaindex.IANA.Name(outputCharset)
+		}
+	}
+	if *cronSpec != "" {
+		var err error
+		if cron, err = parseCron(*cronSpec); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *first && pin > 0 {
+		log.Fatal("-first conflicts with -pin")
+	} else if *first {
+		pin = 0
+	}
+	if *templateFile != "" {
+		t, err := template.New(filepath.Base(*templateFile)).Funcs(templateFuncs).ParseFiles(*templateFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		htmlQuote = t
+	}
+	if *calendarSpec != "" {
+		var err error
+		if calendar, err = parseCalendar(*calendarSpec); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if logSample < 0 || logSample > 1 {
+		log.Fatal("log sample rate must be between 0 and 1")
+	}
+	if bias != "none" && bias != "short" && bias != "long" {
+		log.Fatal("unknown selection bias: " + bias)
+	}
+	if emptyStatus < 200 || emptyStatus > 599 || http.StatusText(emptyStatus) == "" {
+		log.Fatal("empty pool status must be a known HTTP status from 200 to 599")
+	}
+	if *includeRe != "" {
+		var err error
+		if include, err = regexp.Compile(*includeRe); err != nil {
+			log.Fatal("invalid -include pattern: ", err)
+		}
+	}
+	if *excludeRe != "" {
+		var err error
+		if exclude, err = regexp.Compile(*excludeRe); err != nil {
+			log.Fatal("invalid -exclude pattern: ", err)
+		}
+	}
+	if blankLines < 1 {
+		log.Fatal("blank line separator must be at least 1 line")
+	}
+	if streamInterval <= 0 {
+		log.Fatal("stream interval must be positive")
+	}
+	if bucketKey != "" && !strings.HasPrefix(bucketKey, "cookie:") && !strings.HasPrefix(bucketKey, "header:") {
+		log.Fatal("bucket key must be cookie:name or header:name")
+	}
+	if fetchConcurrency < 1 {
+		log.Fatal("fetch concurrency must be at least 1")
+	}
+	if sessionMax <= 0 {
+		log.Fatal("session limit must be positive")
+	}
+	if first := flag.Arg(0); mmapIndex && (flag.NArg() > 1 || strings.Contains(first, "://") || strings.HasPrefix(first, "git+") ||
+		format != "plain" || categories || sourceCharset != nil || len(fallbacks) > 0 || len(sourceLangs.sources) > 0 || filterCmd != "") {
+		log.Fatal("-mmap needs a single plain-format file source, without -categories, -source-charset, -fallback, -source-lang or -filter-cmd")
+	}
+	if mmapIndex && (pin >= 0 || calendar != nil || useSessions || buckets > 0 || bias != "none" || sample > 0) {
+		log.Fatal("-mmap selects quotes uniformly, so conflicts with -pin, -calendar, -sessions, -buckets, -bias and -sample")
+	}
+	if mmapIndex && acceptSubmissions {
+		log.Fatal("-mmap serves the quote file as it is, so conflicts with -accept-submissions")
+	}
+}
+
+// listen binds a TCP listener to address, explaining the
+// common failure of the address already being in use
+func listen(address string) (net.Listener, error) {
+	l, err := net.Listen("tcp", address)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return nil, fmt.Errorf("cannot listen on %s: address already in use; is another server running there? (see -addr and -port)", address)
+	}
+	return l, err
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 func handleQuote(w http.ResponseWriter, r *http.Request) {
-	selection := selectQuote()
+	if acceptSubmissions && r.Method == http.MethodPost {
+		handleSubmit(w, r)
+		return
+	}
+	serveQuote(w, r, qotd.Negotiate(r))
+}
+
+func serveQuote(w http.ResponseWriter, r *http.Request, f formatter) {
+	if v := r.URL.Query().Get("maxlen"); v != "" {
+		maxlen, err := strconv.Atoi(v)
+		if err != nil || maxlen < 0 {
+			fail(w, f, 400, "invalid maxlen")
+			return
+		}
+		idx, selection := selectQuoteWhere(func(q *Quote) bool {
+			return len(q.Text) <= maxlen
+		})
+		if selection == nil {
+			fail(w, f, 404, "no quote short enough")
+			return
+		}
+		writeQuote(w, r, f, idx, poolSize(), selection, false)
+		return
+	}
+
+	if sourceLangs.matcher != nil {
+		w.Header().Add("Vary", "Accept-Language")
+	}
+	// polling with HEAD shouldn't use up quotes
+	peek := r.Method == http.MethodHead
+	idx, size, selection := langQuote(r)
+	if selection == nil {
+		idx, selection = bucketQuote(w, r)
+		size = poolSize()
+	}
+	fresh, cached := wantsFresh(r), false
+	if selection == nil && useSessions && !peek && !fresh {
+		idx, selection = sessionQuote(w, r)
+	} else if selection == nil && fresh {
+		idx, selection = pickQuote(false)
+		if !peek {
+			markServed(idx)
+		}
+	} else if selection == nil {
+		idx, selection = selectQuote()
+		cached = isCachedQuote(selection)
+		if !peek {
+			markServed(idx)
+		}
+	}
 	if selection == nil {
-		w.WriteHeader(503)
+		fail(w, f, emptyStatus, "no quotes available")
+		return
+	}
+	writeQuote(w, r, f, idx, size, selection, cached)
+}
+
+// isCachedQuote reports whether q is the -cache quote
+func isCachedQuote(q *Quote) bool {
+	quotesM.RLock()
+	defer quotesM.RUnlock()
+	return cache > 0 && q != nil && q == quote
+}
+
+// writeQuote renders the selected quote at index idx in its pool
+// of size quotes; only the -cache quote may be cached by clients
+// and proxies, random picks are fresh on every request
+func writeQuote(w http.ResponseWriter, r *http.Request, f formatter, idx, size int, selection *Quote, cached bool) {
+	if r.Method != http.MethodHead {
+		countServed(selection)
+	}
+	q := *selection
+	if sanitizeOutput {
+		q = sanitizeQuote(q)
+	}
+	if number {
+		q.Text = fmt.Sprintf("[%d/%d] %s", idx, size, q.Text)
+	}
+	if wrap > 0 {
+		q.Text = wrapText(q.Text, wrap)
+	}
+
+	if r.Method != http.MethodHead {
+		quoteLengths.observe(uint64(len(q.Text)))
+	}
+
+	if cached {
+		w.Header().Set("Cache-Control",
+			"public, max-age="+strconv.Itoa(int(cacheRemaining()/time.Second)))
+	} else {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	if empty204 && selection.Text == "" {
+		// an empty quote stands for no quote today
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	ct, write := contentType(r, f, q), f.Write
+	// only text; the HTML page declares its own charset
+	if outputCharset != nil && f.ContentType == qotd.Formats["txt"].ContentType && strings.HasSuffix(ct, "; charset=utf-8") {
+		ct = strings.TrimSuffix(ct, "utf-8") + outputName
+		write = func(w io.Writer, q Quote) error {
+			tw := transform.NewWriter(w, encoding.ReplaceUnsupported(outputCharset.NewEncoder()))
+			if err := f.Write(tw, q); err != nil {
+				return err
+			}
+			return tw.Close()
+		}
+	}
+	if richJSON && f.ContentType == qotd.Formats["json"].ContentType {
+		write = richWriter(idx, size)
+	}
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("X-Quote-Count", strconv.Itoa(size))
+	if statusReason && r.ProtoMajor == 1 {
+		var body bytes.Buffer
+		if err := write(&body, q); err != nil {
+			log.Println(err)
+		}
+		if err := writeWithReason(w, r, "Quote-"+strconv.Itoa(idx), body.Bytes()); err != nil {
+			log.Println(err)
+		}
 		return
 	}
-	fmt.Fprintln(w, *selection)
 
-	if verbose {
-		log.Printf(`%s "%s %s %s" "%s"`+"\n",
-			r.RemoteAddr, r.Method, r.URL, r.Proto,
-			r.Header.Get("User-Agent"))
+	if r.Method == http.MethodHead {
+		if indexTrailer {
+			// without a body, there's nothing to trail
+			w.Header().Set("X-Quote-Index", strconv.Itoa(idx))
+		}
+		return
+	}
+	if indexTrailer {
+		// declaring a trailer makes the response chunked
+		w.Header().Set("Trailer", "X-Quote-Index")
+	}
+	if err := write(w, q); err != nil {
+		log.Println(err)
+	}
+	if indexTrailer {
+		w.Header().Set("X-Quote-Index", strconv.Itoa(idx))
 	}
 }
 
-func loadQuotesFromFile(file string) ([]string, error) {
-	f, err := os.Open(file)
+func loadQuotesFromFile(ctx context.Context, file string) ([]Quote, error) {
+	// resolve symlinks on every load, so that atomically
+	// swapped links are picked up by the next reload
+	target, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return nil, err
+	}
+	if verbose && target != file {
+		log.Printf("loading %s via symlink %s\n", target, file)
+	}
+	if fi, err := os.Stat(target); err == nil && fi.Mode()&os.ModeNamedPipe != 0 {
+		return loadQuotesFromFIFO(ctx, target)
+	}
+
+	f, err := os.Open(target)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	qs, err := parseQuotes(f)
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// a link swapped to another file is a change, even if that
+	// file has the same mtime and size
+	v, ok := lastVersion(file)
+	if ok && target == v.target && fi.ModTime().Equal(v.modTime) && fi.Size() == v.size {
+		return v.quotes, errUnchanged
+	}
+
+	qs, err := parseQuotes(ctx, f)
+	if err == nil {
+		storeVersion(file, sourceVersion{target: target, modTime: fi.ModTime(), size: fi.Size(), quotes: qs})
+	}
 	return qs, err
 }
 
-func loadQuotesFromURL(url string) ([]string, error) {
-	resp, err := http.Get(url)
+func newFetchRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if fetchUserAgent != "" {
+		req.Header.Set("User-Agent", fetchUserAgent)
+	}
+	return req, nil
+}
+
+func loadQuotesFromURL(ctx context.Context, url string) ([]Quote, error) {
+	if qs, ok := freshQuotes(url); ok {
+		return qs, errUnchanged
+	}
+	req, err := newFetchRequest(ctx, url)
+	if err != nil {
+		return []Quote{}, err
+	}
+	v, ok := lastVersion(url)
+	if ok && v.etag != "" {
+		req.Header.Set("If-None-Match", v.etag)
+	}
+	if ok && v.lastModified != "" {
+		req.Header.Set("If-Modified-Since", v.lastModified)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return []string{}, err
+		return []Quote{}, err
 	}
 	defer resp.Body.Close()
 
+	if ok && resp.StatusCode == http.StatusNotModified {
+		v.freshUntil = freshUntil(resp.Header)
+		storeVersion(url, v)
+		return v.quotes, errUnchanged
+	}
 	if resp.StatusCode != 200 {
-		return []string{}, errors.New("failed fetching quote source: " + strconv.Itoa(resp.StatusCode))
+		return []Quote{}, errors.New("failed fetching quote source: " + strconv.Itoa(resp.StatusCode))
 	}
 
-	qs, err := parseQuotes(resp.Body)
+	qs, err := parseQuotes(ctx, resp.Body)
+	for page, next := 1, nextPage(resp); err == nil && next != "" && page < maxPages; page++ {
+		var more []Quote
+		if more, next, err = loadPageFromURL(ctx, next); err == nil {
+			qs = append(qs, more...)
+		}
+	}
+	if err == nil {
+		storeVersion(url, sourceVersion{
+			etag:         resp.Header.Get("ETag"),
+			lastModified: resp.Header.Get("Last-Modified"),
+			freshUntil:   freshUntil(resp.Header),
+			quotes:       qs,
+		})
+	}
 	return qs, err
 }
 
-func fetchQuotes(source string) ([]string, error) {
+// loadPageFromURL loads a single page of a paginated URL source,
+// returning its quotes and the URL of the next page, if any
+func loadPageFromURL(ctx context.Context, url string) ([]Quote, string, error) {
+	req, err := newFetchRequest(ctx, url)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, "", errors.New("failed fetching quote source page: " + strconv.Itoa(resp.StatusCode))
+	}
+	qs, err := parseQuotes(ctx, resp.Body)
+	return qs, nextPage(resp), err
+}
+
+// nextPage returns the absolute rel="next" target of the
+// response's Link header, or "" if there is none
+func nextPage(resp *http.Response) string {
+	for _, link := range strings.Split(strings.Join(resp.Header.Values("Link"), ","), ",") {
+		parts := strings.Split(link, ";")
+		target := strings.Trim(strings.TrimSpace(parts[0]), "<>")
+		for _, param := range parts[1:] {
+			if p := strings.TrimSpace(param); p != `rel="next"` && p != "rel=next" {
+				continue
+			}
+			if u, err := resp.Request.URL.Parse(target); err == nil {
+				return u.String()
+			}
+		}
+	}
+	return ""
+}
+
+// fetchQuotes loads source and tags its quotes with it
+func fetchQuotes(ctx context.Context, source string) ([]Quote, error) {
+	qs, err := loadQuotes(ctx, source)
+	// unchanged sources hand back their cached quotes, which may
+	// also be in a live pool; tag a copy rather than those
+	tagged := make([]Quote, len(qs))
+	for i, q := range qs {
+		q.Source = source
+		tagged[i] = q
+	}
+	return tagged, err
+}
+
+// loadQuotes loads source by its scheme; cancelling ctx aborts
+// fetches of remote sources
+func loadQuotes(ctx context.Context, source string) ([]Quote, error) {
 	switch {
 	case strings.HasPrefix(source, "https://"):
-		return loadQuotesFromURL(source)
+		return guardFetch(ctx, source, loadQuotesFromURL)
 	case strings.HasPrefix(source, "http://"):
-		return loadQuotesFromURL(source)
+		return guardFetch(ctx, source, loadQuotesFromURL)
+	case strings.HasPrefix(source, "git+"):
+		return loadQuotesFromGit(ctx, source)
+	case strings.HasPrefix(source, "sqlite://"):
+		return loadQuotesFromSQLite(ctx, source)
 	default:
-		return loadQuotesFromFile(source)
+		return loadQuotesFromFile(ctx, source)
 	}
 }
 
-func parseQuotes(r io.Reader) ([]string, error) {
-	qs := []string{}
-	acc := []string{}
+// collectQuotes returns an empty pool and a function adding
+// quotes to it, applying -trim, -sample and -strict
+func collectQuotes(ctx context.Context) (*reservoir, func(Quote)) {
+	res := &reservoir{}
+	add := func(q Quote) {
+		res.entries++
+		q, problem := prepareQuote(ctx, q)
+		if problem != "" {
+			res.warn(fmt.Sprintf("quote %d: %s", res.entries, problem))
+			return
+		}
+		res.add(q)
+	}
+	return res, add
+}
 
-	scan := bufio.NewScanner(r)
-	for scan.Scan() {
-		line := scan.Text()
-		if strings.HasPrefix(line, "#") {
-			continue
+// prepareQuote trims, checks and filters a parsed or submitted
+// quote, inlining its image; if it's to be skipped, it returns
+// why
+func prepareQuote(ctx context.Context, q Quote) (Quote, string) {
+	if trim {
+		q.Text = strings.TrimSpace(q.Text)
+	}
+	if problem := checkQuote(q); problem != "" {
+		return q, problem
+	}
+	if filterCmd != "" {
+		var err error
+		if q.Text, err = filterQuote(q.Text); err != nil {
+			return q, err.Error()
+		}
+		if q.Text == "" && !empty204 {
+			return q, "filter printed nothing"
+		}
+	}
+	if q.Image != "" {
+		var err error
+		if q.Image, err = inlineImage(ctx, q.Image); err != nil {
+			return q, err.Error()
+		}
+	}
+	q.Hash = qotd.Hash(q.Text)
+	return q, ""
+}
+
+// checkQuote describes what's wrong with q, if anything
+func checkQuote(q Quote) string {
+	switch {
+	case q.Text == "" && !empty204:
+		return "empty quote"
+	case !utf8.ValidString(q.Text):
+		return "invalid UTF-8"
+	case maxQuote > 0 && len(q.Text) > maxQuote:
+		return fmt.Sprintf("longer than %d bytes", maxQuote)
+	}
+	return ""
+}
+
+func parseQuotes(ctx context.Context, r io.Reader) ([]Quote, error) {
+	res, add := collectQuotes(ctx)
+	if sourceCharset != nil {
+		r = sourceCharset.NewDecoder().Reader(r)
+	}
+
+	switch format {
+	case "csv":
+		if err := parseCSV(r, add); err != nil {
+			return nil, err
+		}
+	default:
+		if err := qotd.ParsePlain(r, plainOptions(), add); err != nil {
+			return nil, err
 		}
+	}
 
-		if strings.HasPrefix(line, "\\#") {
-			line = line[1:]
+	return res.qs, res.err
+}
+
+// plainOptions returns the options to parse plain-format
+// sources with, as set by the flags
+func plainOptions() qotd.ParseOptions {
+	return qotd.ParseOptions{
+		MaxLine:         maxLine,
+		BlankLines:      blankLines,
+		CommentsBetween: commentsBetween,
+		Categories:      categories,
+		NoEscape:        !escape,
+	}
+}
+
+// parseCSV reads text,author records; the author column is optional
+// and a leading "text,author" header row is skipped
+func parseCSV(r io.Reader, add func(Quote)) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	for first := true; ; first = false {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
 		}
 
-		if len(line) > 0 {
-			if line == "\\" {
-				line = ""
-			}
-			acc = append(acc, line)
-		} else if len(acc) > 0 {
-			qs = append(qs, strings.Join(acc, "\n"))
-			acc = []string{}
+		if first && strings.EqualFold(rec[0], "text") {
+			continue
 		}
+
+		q := Quote{Text: rec[0]}
+		if len(rec) > 1 {
+			q.Author = rec[1]
+		}
+		add(q)
 	}
+}
+
+// reservoir retains at most sample quotes chosen uniformly at random:
+// once full, the n-th quote replaces a random entry with probability sample/n
+type reservoir struct {
+	qs []Quote
+	n  int
+
+	entries int   // quotes seen, including rejected ones
+	err     error // first problem found in -strict mode
+}
+
+// warn fails the load in -strict mode, and otherwise
+// logs that a quote was skipped
+func (res *reservoir) warn(problem string) {
+	if !strict {
+		log.Println(problem + "; skipped")
+	} else if res.err == nil {
+		res.err = errors.New(problem)
+	}
+}
+
+func (res *reservoir) add(q Quote) {
+	res.n++
+	if sample <= 0 || len(res.qs) < sample {
+		res.qs = append(res.qs, q)
+	} else if j := rand.Intn(res.n); j < sample {
+		res.qs[j] = q
+	}
+}
+
+// selectQuote returns the quote to serve and its index in the pool
+func selectQuote() (int, *Quote) {
+	return pickQuote(true)
+}
+
+// wantsFresh reports whether the request asks for a quote other
+// than the -cache one, with ?fresh=1
+func wantsFresh(r *http.Request) bool {
+	fresh, _ := strconv.ParseBool(r.URL.Query().Get("fresh"))
+	return fresh
+}
+
+// pickQuote is selectQuote, but only serves the cached quote if
+// cached is set; the cached quote stays as it is either way
+func pickQuote(cached bool) (int, *Quote) {
+	s := pool.Snapshot()
+	if pin >= 0 && pin < len(s.Quotes) {
+		return pin, &s.Quotes[pin]
+	}
+	if idx, q := calendarQuote(s, time.Now()); q != nil {
+		return idx, q
+	}
+	if cache > 0 && cached {
+		quotesM.RLock()
+		defer quotesM.RUnlock()
+		return quoteIdx, quote
+	}
+
+	return nextQuoteRaw()
+}
 
-	qs = append(qs, strings.Join(acc, "\n"))
-	return qs, nil
+// keepCachedQuote points the cached quote at its copy in the
+// new pool, returning false if the pool no longer has it or
+// there's no cached quote; quotesM must be held
+func keepCachedQuote() bool {
+	if cache <= 0 || quote == nil {
+		return false
+	}
+	qs := pool.Quotes()
+	for i := range qs {
+		if qs[i].Hash == quote.Hash && qs[i].Text == quote.Text {
+			quoteIdx, quote = i, &qs[i]
+			return true
+		}
+	}
+	return false
 }
 
-func selectQuote() *string {
+// cacheRemaining returns how long until the cached quote expires
+func cacheRemaining() time.Duration {
 	quotesM.RLock()
 	defer quotesM.RUnlock()
 
-	if cache > 0 {
-		return quote
+	if left := cache - time.Since(cachedAt); left > 0 {
+		return left
 	}
+	return 0
+}
 
-	return nextQuoteRaw()
+// selectQuoteWhere picks a random quote among those matching keep
+func selectQuoteWhere(keep func(*Quote) bool) (int, *Quote) {
+	if mmapIndex {
+		return mappedQuoteWhere(keep)
+	}
+	qs := pool.Quotes()
+	matches := []int{}
+	for i := range qs {
+		if keep(&qs[i]) {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) == 0 {
+		return -1, nil
+	}
+
+	idx := matches[rand.Intn(len(matches))]
+	return idx, &qs[idx]
 }
 
-func nextQuoteRaw() *string {
-	if quotes == nil || len(*quotes) == 0 {
-		return nil
+// poolSize returns the number of quotes in the pool
+func poolSize() int {
+	if mmapIndex {
+		return mappedSize()
 	}
+	return pool.Len()
+}
+
+// sampleQuotes returns up to n distinct quotes in random order
+func sampleQuotes(n int) []Quote {
+	all := pool.Quotes()
+	if n > len(all) {
+		n = len(all)
+	}
+	qs := make([]Quote, n)
+	for i, idx := range rand.Perm(len(all))[:n] {
+		qs[i] = all[idx]
+	}
+	return qs
+}
 
-	idx := rand.Intn(len(*quotes))
-	return &(*quotes)[idx]
+// nextQuoteRaw picks a quote from the pool, ignoring -pin and
+// -cache; quotesM must be held for writing if the result is
+// stored as the cached quote
+func nextQuoteRaw() (int, *Quote) {
+	if mmapIndex {
+		return mappedQuote()
+	}
+	s := pool.Snapshot()
+	if len(s.Quotes) == 0 {
+		return -1, nil
+	}
+	idx := avoidRecent(s.Pick(), len(s.Quotes), s.Pick)
+	return idx, &s.Quotes[idx]
 }
 
-func reloadQuotes(source string) error {
-	newQuotes, err := fetchQuotes(source)
+// dedupQuotes drops quotes whose text was already seen,
+// keeping the first occurrence
+func dedupQuotes(qs []Quote) []Quote {
+	seen := make(map[string]bool, len(qs))
+	unique := make([]Quote, 0, len(qs))
+	for _, q := range qs {
+		if !seen[q.Text] {
+			seen[q.Text] = true
+			unique = append(unique, q)
+		}
+	}
+	return unique
+}
+
+// matchingQuotes keeps the quotes that do (or don't) match re
+func matchingQuotes(qs []Quote, re *regexp.Regexp, match bool) []Quote {
+	kept := make([]Quote, 0, len(qs))
+	for _, q := range qs {
+		if re.MatchString(q.Text) == match {
+			kept = append(kept, q)
+		}
+	}
+	return kept
+}
+
+// loadSources loads up to -fetch-concurrency sources at a time and
+// merges them in the order given, reporting whether any of them
+// changed since the last load. With -drop-failed-sources, failing
+// sources are left out as long as any other source loads.
+func loadSources(ctx context.Context, sources []string) ([]Quote, bool, error) {
+	type result struct {
+		qs  []Quote
+		err error
+	}
+	results := make([]result, len(sources))
+	slots := make(chan struct{}, fetchConcurrency)
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, source string) {
+			defer wg.Done()
+			qs, err := fetchQuotes(ctx, source)
+			results[i] = result{qs, err}
+			<-slots
+		}(i, source)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, false, ctx.Err()
+	}
+	changed := false
+	for i, source := range sources {
+		// a source dropping out or coming back changes the pool
+		if recordLoad(source, results[i].err) && dropFailed {
+			changed = true
+		}
+	}
+
+	merged := []Quote{}
+	var lastErr error
+	failed := 0
+	for i, source := range sources {
+		qs, err := results[i].qs, results[i].err
+		switch {
+		case err == nil:
+			changed = true
+		case err == errUnchanged:
+		case dropFailed:
+			log.Printf("%v; leaving out %s until it recovers", err, source)
+			lastErr = err
+			failed++
+			continue
+		default:
+			return nil, false, err
+		}
+		merged = append(merged, qs...)
+	}
+	if failed > 0 && failed == len(sources) {
+		return nil, false, lastErr
+	}
+	return merged, changed, nil
+}
+
+// reloadQuotes loads the given sources, failing over
+// to each fallback source in turn if that fails; cancelling
+// ctx aborts the reload
+func reloadQuotes(ctx context.Context, sources []string) error {
+	if staging != "" {
+		if err := promoteStaging(ctx, sources[0]); err != nil {
+			return err
+		}
+	}
+	if mmapIndex {
+		return remapQuotes(ctx, sources[0])
+	}
+	newQuotes, changed, err := loadSources(ctx, sources)
+	if err == errBreakerOpen {
+		// keep whatever pool the breaker tripped on
+		if verbose {
+			log.Println("circuit breaker open; reload skipped")
+		}
+		return nil
+	}
+	fallback := ""
+	for i := 0; err != nil && ctx.Err() == nil && i < len(fallbacks); i++ {
+		log.Printf("%v; trying fallback %s\n", err, fallbacks[i])
+		fallback = fallbacks[i]
+		if newQuotes, err = fetchQuotes(ctx, fallback); err == errUnchanged {
+			err = nil
+		}
+	}
 	if err != nil {
 		return err
 	}
+
+	if len(sourceLangs.sources) > 0 {
+		pools, err := loadLangSources(ctx)
+		if err != nil {
+			return err
+		}
+		quotesM.Lock()
+		langQuotes = pools
+		quotesM.Unlock()
+	}
+
+	// the pool may only be kept if it came from the same sources,
+	// and submissions don't outlive a reload either way
+	quotesM.RLock()
+	changed = changed || submitted > 0
+	quotesM.RUnlock()
+	if !changed && fallback == "" && loadedFallback == "" {
+		if verbose {
+			log.Println("source unchanged")
+		}
+		countReload()
+		return nil
+	}
+
+	if dedup {
+		n := len(newQuotes)
+		newQuotes = dedupQuotes(newQuotes)
+		if verbose {
+			log.Printf("removed %d duplicate quotes\n", n-len(newQuotes))
+		}
+	}
+	if include != nil {
+		n := len(newQuotes)
+		newQuotes = matchingQuotes(newQuotes, include, true)
+		if verbose {
+			log.Printf("dropped %d quotes not matching -include\n", n-len(newQuotes))
+		}
+	}
+	if exclude != nil {
+		n := len(newQuotes)
+		newQuotes = matchingQuotes(newQuotes, exclude, false)
+		if verbose {
+			log.Printf("excluded %d quotes\n", n-len(newQuotes))
+		}
+	}
+
+	if keepLastGood && len(newQuotes) == 0 && poolSize() > 0 {
+		return errors.New("reload yielded no quotes; keeping the previous pool")
+	}
+
+	if pin >= len(newQuotes) {
+		return fmt.Errorf("pinned quote %d out of range; pool has %d quotes", pin, len(newQuotes))
+	}
+
+	loadedFallback = fallback
 	quotesM.Lock()
-	quotes = &newQuotes
-	quote = nextQuoteRaw()
+	setQuotes(newQuotes)
+	reloadedAt = time.Now()
+	submitted = 0
+	kept := !reselectOnReload && keepCachedQuote()
+	if !kept {
+		quoteIdx, quote = nextQuoteRaw()
+		notifyWebhook("reload", quoteIdx, quote)
+	}
 	quotesM.Unlock()
-	if verbose {
+	mergeServeCounts(newQuotes)
+	atomic.StoreInt32(&loaded, 1)
+	if verbose && kept {
+		log.Println("quotes reloaded; cached quote kept")
+	} else if verbose {
 		log.Println("quotes reloaded; cached quote reselected")
 	}
+	countReload()
 	return nil
 }
 
+// reloadDelay is the reload interval, doubled for each consecutive
+// failure up to the -reload-backoff cap
+func reloadDelay(failures int) time.Duration {
+	d := reload
+	for i := 0; i < failures && d < backoff; i++ {
+		d *= 2
+	}
+	if d > backoff && backoff > reload {
+		d = backoff
+	}
+	return d
+}
+
+// Quote is a single entry in the quote pool
+type Quote = qotd.Quote
+
 func main() {
+	parseFlags()
 
-	source := os.Args[len(os.Args)-1]
-	if err := reloadQuotes(source); err != nil {
-		log.Fatal(err)
+	// cancelled on shutdown, so a reload stuck on a slow
+	// source doesn't hold it up
+	base, stop := context.WithCancel(context.Background())
+
+	sources := flag.Args()
+	if !lazy {
+		if err := reloadQuotes(base, sources); err != nil {
+			log.Fatal(err)
+		}
+	}
+	startedAt = time.Now()
+	go runReloads(base, sources)
+	if watch {
+		watched := append(append([]string{}, sources...), fallbacks...)
+		if staging != "" {
+			watched = append(watched, staging)
+		}
+		if err := watchSources(watched); err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", handleQuote)
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		if quotes != nil || len(*quotes) == 0 {
-			w.WriteHeader(503)
-		}
-	})
+	quoteChain := chain(quoteMiddlewares()...)
+	poolChain := chain(poolMiddlewares()...)
+	aclChain := chain(aclMiddlewares()...)
+	if noRoot {
+		mux.HandleFunc("/", http.NotFound)
+	} else {
+		mux.Handle("/", quoteChain(http.HandlerFunc(handleQuote)))
+	}
+	mux.Handle("/quote", quoteChain(http.HandlerFunc(handleQuote)))
+	mux.Handle("/quote.txt", quoteChain(formatHandler("txt")))
+	mux.Handle("/quote.json", quoteChain(formatHandler("json")))
+	mux.Handle("/quote.html", quoteChain(formatHandler("html")))
+	mux.Handle("/quote.png", quoteChain(http.HandlerFunc(handleQR)))
+	mux.Handle("/quotes", quoteChain(http.HandlerFunc(handleQuotes)))
+	mux.Handle("/quote/by-hash/", quoteChain(http.HandlerFunc(handleByHash)))
+	mux.Handle("/authors", quoteChain(http.HandlerFunc(handleAuthors)))
+	mux.Handle("/by/", quoteChain(http.HandlerFunc(handleByAuthor)))
+	mux.Handle("/c/", quoteChain(http.HandlerFunc(handleByCategory)))
+	mux.Handle("/stream", quoteChain(http.HandlerFunc(handleStream)))
+	mux.HandleFunc("/metrics", handleMetrics)
+	mux.Handle("/all", poolChain(http.HandlerFunc(handleAll)))
+	mux.Handle("/status", aclChain(http.HandlerFunc(handleStatus)))
+	mux.Handle("/stats/lengths", poolChain(http.HandlerFunc(handleLengthStats)))
+	mux.Handle("/stats/served", poolChain(http.HandlerFunc(handleServed)))
+	if enableUI {
+		mux.Handle("/ui", poolChain(http.HandlerFunc(handleUI)))
+	} else {
+		mux.HandleFunc("/ui", http.NotFound)
+	}
+	if enablePprof {
+		// heap profiles hold the pool, the command line its sources
+		mux.Handle("/debug/pprof/", aclChain(http.HandlerFunc(pprof.Index)))
+		mux.Handle("/debug/pprof/cmdline", aclChain(http.HandlerFunc(pprof.Cmdline)))
+		mux.Handle("/debug/pprof/profile", aclChain(http.HandlerFunc(pprof.Profile)))
+		mux.Handle("/debug/pprof/symbol", aclChain(http.HandlerFunc(pprof.Symbol)))
+		mux.Handle("/debug/pprof/trace", aclChain(http.HandlerFunc(pprof.Trace)))
+	} else {
+		// don't let / answer for these with a quote
+		mux.HandleFunc("/debug/pprof/", http.NotFound)
+	}
+	if enableDistribution {
+		mux.Handle("/debug/distribution", poolChain(http.HandlerFunc(handleDistribution)))
+	} else {
+		mux.HandleFunc("/debug/distribution", http.NotFound)
+	}
+	mux.HandleFunc("/ping", handlePing)
+	mux.HandleFunc("/readyz", handleReady)
+	mux.HandleFunc("/health", handleHealth)
 
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan,
 		os.Interrupt,
 		syscall.SIGINT,
 		syscall.SIGTERM,
-		syscall.SIGHUP)
+		syscall.SIGHUP,
+		syscall.SIGUSR1)
+
+	// sockets passed by systemd take the place of -addr and -port;
+	// those named "gopher" take the place of -gopher
+	passed, err := activationListeners()
+	if err != nil {
+		log.Fatal(err)
+	}
+	gophers := passed["gopher"]
+	delete(passed, "gopher")
+	listeners := []net.Listener{}
+	for _, ls := range passed {
+		listeners = append(listeners, ls...)
+	}
+	if len(listeners) == 0 {
+		for _, a := range strings.Split(addr, ",") {
+			for _, p := range strings.Split(port, ",") {
+				// bind here rather than in the server goroutines,
+				// so a taken port is reported before serving anything
+				l, err := listen(a + ":" + p)
+				if err != nil {
+					log.Fatal(err)
+				}
+				listeners = append(listeners, l)
+			}
+		}
+	}
+
+	// one server for each listener
+	servers := []*http.Server{}
+	for _, l := range listeners {
+		l := l
+		srv := &http.Server{Handler: mux}
+		servers = append(servers, srv)
+		go func() {
+			err := srv.Serve(l)
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	if gopher != "" && len(gophers) == 0 {
+		for _, a := range strings.Split(addr, ",") {
+			l, err := listen(a + ":" + gopher)
+			if err != nil {
+				log.Fatal(err)
+			}
+			gophers = append(gophers, l)
+		}
+	}
+	for _, l := range gophers {
+		go serveGopher(l)
+	}
 
-	srv := http.Server{Addr: addr + ":" + port, Handler: mux}
 	go func() {
-		err := srv.ListenAndServe()
-		if err != nil && err != http.ErrServerClosed {
-			log.Fatal(err)
+		if reload > 0 {
+			failures := 0
+			for {
+				time.Sleep(reloadDelay(failures))
+				if err := <-requestReload(); err != nil {
+					failures++
+				} else {
+					failures = 0
+				}
+			}
 		}
 	}()
 
 	go func() {
-		if reload > 0 {
-			t := time.NewTicker(reload)
+		if cron != nil {
 			for {
-				<-t.C
-				if err := reloadQuotes(source); err != nil {
-					log.Println(err)
+				next := cron.next(time.Now())
+				if next.IsZero() {
+					log.Println("reload schedule never fires")
+					return
 				}
+				time.Sleep(time.Until(next))
+				requestReload()
 			}
 		}
 	}()
 
 	go func() {
 		if cache > 0 {
+			quotesM.Lock()
 			t := time.NewTicker(cache)
+			cachedAt = time.Now()
+			quotesM.Unlock()
 			for {
 				<-t.C
 				quotesM.Lock()
-				if quote = nextQuoteRaw(); quote != nil && verbose {
-					log.Println("cached quote reselected")
+				cachedAt = time.Now()
+				if quoteIdx, quote = nextQuoteRaw(); quote != nil && verbose {
+					log.Printf("cached quote reselected: %q\n", preview(quote.Text, previewLen))
 				}
+				notifyWebhook("reselect", quoteIdx, quote)
 				quotesM.Unlock()
 			}
 		}
 	}()
 
+	shutdown := func() { shutdownServers(servers, gophers, stop) }
+
+	// the initial load is done and the listeners are bound
+	sdNotify("READY=1")
+	notifyParent()
+
 	for {
 		select {
 		case sig := <-sigchan:
 			switch sig {
 			case syscall.SIGHUP:
-				log.Println("caught SIGHUP; reloading…")
-				if err := reloadQuotes(source); err != nil {
+				if !hupRestart {
+					log.Println("caught SIGHUP; reloading…")
+					forceReload()
+					continue
+				}
+				pid, err := restartSelf(listeners, gophers)
+				if err != nil {
+					log.Println("restart failed:", err)
+					continue
+				}
+				log.Printf("caught SIGHUP; restarted as pid %d, shutting down…\n", pid)
+				shutdown()
+				return
+			case syscall.SIGUSR1:
+				if snapshotDir == "" {
+					log.Println("caught SIGUSR1; no -snapshot-dir set")
+					continue
+				}
+				if path, err := snapshotQuotes(); err != nil {
 					log.Println(err)
+				} else {
+					log.Println("caught SIGUSR1; wrote snapshot to", path)
 				}
 			default:
 				log.Println("caught signal; shutting down…")
-				shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-				defer cancel()
-				if err := srv.Shutdown(shutdown); err != nil {
-					log.Fatal("server shutdown failed")
-				}
+				shutdown()
 				return
 			}
+		case <-retired:
+			log.Println("reached -max-reloads; shutting down…")
+			shutdown()
+			return
+		}
+	}
+}
+
+// shutdownServers fails /health, waits out -shutdown-drain and then
+// shuts the servers down once their requests are done
+func shutdownServers(servers []*http.Server, gophers []net.Listener, stop func()) {
+	sdNotify("STOPPING=1")
+	atomic.StoreInt32(&shuttingDown, 1)
+	time.Sleep(shutdownDrain)
+	stop()
+	// requests in flight, delayed ones included, are left
+	// to drain; only streams are ended early
+	close(streamsDone)
+	for _, l := range gophers {
+		l.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Fatal("server shutdown failed")
 		}
 	}
 }
@@ -0,0 +1,1689 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// set for test binaries started to run as the server
+const testDaemonEnv = "HTTPQOTDD_TEST_DAEMON"
+
+func TestMain(m *testing.M) {
+	// -hup-restart tests run the test binary as the new instance,
+	// and others run it as a server of its own
+	if os.Getenv(restartParentEnv) != "" || os.Getenv(testDaemonEnv) != "" {
+		main()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// writeSources writes each of srcs to a file, returning their names
+func writeSources(t *testing.T, srcs ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	files := make([]string, len(srcs))
+	for i, src := range srcs {
+		files[i] = filepath.Join(dir, fmt.Sprintf("quotes%d.txt", i))
+		if err := ioutil.WriteFile(files[i], []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+// loadPool replaces the pool with the quotes in srcs, each given
+// in the plain source format, the way a reload would
+func loadPool(t *testing.T, srcs ...string) {
+	t.Helper()
+	if err := reloadQuotes(context.Background(), writeSources(t, srcs...)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		quotesM.Lock()
+		setQuotes(nil)
+		quote, quoteIdx = nil, -1
+		quotesM.Unlock()
+		atomic.StoreInt32(&loaded, 0)
+	})
+}
+
+// poolTexts returns the texts of the quotes in the pool
+func poolTexts() []string {
+	texts := []string{}
+	for _, q := range pool.Quotes() {
+		texts = append(texts, q.Text)
+	}
+	return texts
+}
+
+// setFlag sets the named flag for the rest of the test
+func setFlag(t *testing.T, name, value string) {
+	t.Helper()
+	f := flag.Lookup(name)
+	old := f.Value.String()
+	if err := f.Value.Set(value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Value.Set(old) })
+}
+
+// daemon is the test binary running as the server
+type daemon struct {
+	cmd    *exec.Cmd
+	notify *net.UnixConn // receives its sd_notify states
+	log    syncBuffer
+	exited chan struct{}
+	err    error // once exited
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	b bytes.Buffer
+	m sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.b.String()
+}
+
+// captureLog collects the log output for the rest of the test
+func captureLog(t *testing.T) *syncBuffer {
+	t.Helper()
+	b := &syncBuffer{}
+	log.SetOutput(b)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return b
+}
+
+// daemonCommand prepares a server run with args, binding to
+// 127.0.0.1 unless they say otherwise; its LISTEN_PID is set to
+// its own pid, as systemd would
+func daemonCommand(t *testing.T, args ...string) *daemon {
+	t.Helper()
+	// socket paths are limited to about 100 bytes
+	dir, err := ioutil.TempDir("", "httpqotdd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	notify, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(dir, "notify"), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { notify.Close() })
+
+	d := &daemon{notify: notify, exited: make(chan struct{})}
+	d.cmd = exec.Command("/bin/sh", append([]string{"-c", `LISTEN_PID=$$ exec "$0" "$@"`, os.Args[0], "-addr", "127.0.0.1"}, args...)...)
+	d.cmd.Env = append(os.Environ(), testDaemonEnv+"=1", "NOTIFY_SOCKET="+notify.LocalAddr().String())
+	d.cmd.Stdout, d.cmd.Stderr = &d.log, &d.log
+	return d
+}
+
+func (d *daemon) start(t *testing.T) {
+	t.Helper()
+	if err := d.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		d.err = d.cmd.Wait()
+		close(d.exited)
+	}()
+	t.Cleanup(func() {
+		d.cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-d.exited:
+		case <-time.After(10 * time.Second):
+			d.cmd.Process.Kill()
+			<-d.exited
+		}
+		if t.Failed() {
+			t.Logf("server log:\n%s", d.log.String())
+		}
+	})
+}
+
+// startDaemon starts a server with args and waits for it to be ready
+func startDaemon(t *testing.T, args ...string) *daemon {
+	t.Helper()
+	d := daemonCommand(t, args...)
+	d.start(t)
+	d.await(t, "READY=1")
+	return d
+}
+
+// await waits for the server to notify the service manager of state
+func (d *daemon) await(t *testing.T, state string) {
+	t.Helper()
+	d.notify.SetReadDeadline(time.Now().Add(10 * time.Second))
+	buf := make([]byte, 256)
+	for {
+		n, err := d.notify.Read(buf)
+		if err != nil {
+			t.Fatalf("awaiting %s: %v", state, err)
+		}
+		if string(buf[:n]) == state {
+			return
+		}
+	}
+}
+
+// awaitLog waits for the server to log want; its output may trail
+// behind its notifications
+func (d *daemon) awaitLog(t *testing.T, want string) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); !strings.Contains(d.log.String(), want); {
+		if time.Now().After(deadline) {
+			t.Fatalf("log lacks %s", want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// wait waits for the server to exit, returning how it did
+func (d *daemon) wait(t *testing.T) error {
+	t.Helper()
+	select {
+	case <-d.exited:
+		return d.err
+	case <-time.After(10 * time.Second):
+		t.Fatal("server still running")
+		return nil
+	}
+}
+
+// freePort returns a currently unused local TCP port
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+// fetch GETs url, returning the status and body
+func fetch(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestShutdownDrain(t *testing.T) {
+	loadPool(t, "a quote\n")
+	setFlag(t, "shutdown-drain", "300ms")
+	t.Cleanup(func() {
+		atomic.StoreInt32(&shuttingDown, 0)
+		streamsDone = make(chan struct{})
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(handleHealth))
+	defer srv.Close()
+	health := func() (int, error) {
+		resp, err := http.Get(srv.URL + "/health")
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	if code, err := health(); err != nil || code != 200 {
+		t.Fatalf("before shutdown: got %d, %v; want 200", code, err)
+	}
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		shutdownServers([]*http.Server{srv.Config}, nil, func() {})
+		close(done)
+	}()
+	for atomic.LoadInt32(&shuttingDown) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if code, err := health(); err != nil || code != 503 {
+		t.Fatalf("while draining: got %d, %v; want 503", code, err)
+	}
+
+	<-done
+	if elapsed := time.Since(start); elapsed < shutdownDrain {
+		t.Errorf("shut down after %v, before the %v drain", elapsed, shutdownDrain)
+	}
+	if _, err := health(); err == nil {
+		t.Error("still serving after shutdown")
+	}
+}
+
+// TestConcurrentReloads hammers selection while reloading; it's
+// meant to be run with -race
+func TestConcurrentReloads(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags map[string]string
+	}{
+		{"plain", nil},
+		{"cache", map[string]string{"cache": "1h"}},
+		{"sessions", map[string]string{"sessions": "true"}},
+		{"skip unchanged", map[string]string{"skip-unchanged": "true"}},
+		{"bias", map[string]string{"bias": "short"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.flags {
+				setFlag(t, name, value)
+			}
+			dir := t.TempDir()
+			file := filepath.Join(dir, "quotes.txt")
+			de := filepath.Join(dir, "de.txt")
+			ioutil.WriteFile(de, []byte("ein Zitat\n\nnoch eins\n"), 0644)
+			langs := sourceLangs
+			sourceLangs = langSourceList{}
+			sourceLangs.Set("de:" + de)
+			t.Cleanup(func() { sourceLangs = langs })
+
+			loadPool(t, "a quote\n")
+			sources := []string{file}
+			write := func(i int) {
+				src := "a quote\n"
+				for j := 0; j < i%3; j++ {
+					src += "\nanother quote\n"
+				}
+				ioutil.WriteFile(file, []byte(src), 0644)
+			}
+			write(0)
+			if err := reloadQuotes(context.Background(), sources); err != nil {
+				t.Fatal(err)
+			}
+
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						for _, lang := range []string{"", "de"} {
+							req := httptest.NewRequest("GET", "/quote", nil)
+							req.Header.Set("Accept-Language", lang)
+							rec := httptest.NewRecorder()
+							handleQuote(rec, req)
+							if rec.Code != 200 || rec.Body.Len() == 0 {
+								t.Errorf("got %d %q while reloading", rec.Code, rec.Body)
+								return
+							}
+						}
+						handleAll(httptest.NewRecorder(), httptest.NewRequest("GET", "/all", nil))
+						handleHealth(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+						sampleQuotes(2)
+					}
+				}()
+			}
+			for i := 1; i <= 50; i++ {
+				write(i)
+				if err := reloadQuotes(context.Background(), sources); err != nil && err != errUnchanged {
+					t.Error(err)
+				}
+			}
+			close(stop)
+			wg.Wait()
+		})
+	}
+}
+
+func TestSample(t *testing.T) {
+	src := ""
+	for i := 0; i < 1000; i++ {
+		src += fmt.Sprintf("quote %d\n\n", i)
+	}
+	tests := []struct {
+		sample string
+		want   int
+	}{
+		{"0", 1000},
+		{"1", 1},
+		{"10", 10},
+		{"1000", 1000},
+		{"5000", 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sample, func(t *testing.T) {
+			setFlag(t, "sample", tt.sample)
+			qs, err := parseQuotes(context.Background(), strings.NewReader(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(qs) != tt.want {
+				t.Fatalf("retained %d quotes; want %d", len(qs), tt.want)
+			}
+			seen := map[int]bool{}
+			for _, q := range qs {
+				var i int
+				if _, err := fmt.Sscanf(q.Text, "quote %d", &i); err != nil || i < 0 || i >= 1000 {
+					t.Fatalf("retained %q, which isn't in the source", q.Text)
+				}
+				if seen[i] {
+					t.Fatalf("retained %q twice", q.Text)
+				}
+				seen[i] = true
+			}
+		})
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	setFlag(t, "format", "csv")
+	tests := []struct {
+		name string
+		src  string
+		want []Quote
+	}{
+		{"empty", "", nil},
+		{"text only", "a quote\nanother\n", []Quote{{Text: "a quote"}, {Text: "another"}}},
+		{"author", "a quote,Someone\n", []Quote{{Text: "a quote", Author: "Someone"}}},
+		{"header", "text,author\na quote,Someone\n", []Quote{{Text: "a quote", Author: "Someone"}}},
+		{"multiline", "\"first line\nsecond, with a comma\",Someone\nnext,\n",
+			[]Quote{{Text: "first line\nsecond, with a comma", Author: "Someone"}, {Text: "next"}}},
+		{"escaped quotes", `"she said ""hi""",Someone` + "\n", []Quote{{Text: `she said "hi"`, Author: "Someone"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qs, err := parseQuotes(context.Background(), strings.NewReader(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(qs) != len(tt.want) {
+				t.Fatalf("got %d quotes; want %d", len(qs), len(tt.want))
+			}
+			for i, q := range qs {
+				if q.Text != tt.want[i].Text || q.Author != tt.want[i].Author {
+					t.Errorf("quote %d = %q by %q; want %q by %q", i, q.Text, q.Author, tt.want[i].Text, tt.want[i].Author)
+				}
+			}
+		})
+	}
+
+	if _, err := parseQuotes(context.Background(), strings.NewReader("\"unterminated\n")); err == nil {
+		t.Error("parsed an unterminated quoted field")
+	}
+}
+
+func TestTrim(t *testing.T) {
+	tests := []struct {
+		trim string
+		src  string
+		want []string
+	}{
+		{"false", "  padded  \n", []string{"  padded  "}},
+		{"true", "  padded  \n", []string{"padded"}},
+		{"true", "\t first line \n  second line\t\n\nnext  \n", []string{"first line \n  second line", "next"}},
+		{"true", "   \n", nil},
+	}
+	for _, tt := range tests {
+		setFlag(t, "trim", tt.trim)
+		qs, err := parseQuotes(context.Background(), strings.NewReader(tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, q := range qs {
+			got = append(got, q.Text)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) || len(got) != len(tt.want) {
+			t.Errorf("-trim=%s: parsed %q as %q; want %q", tt.trim, tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestDedup(t *testing.T) {
+	tests := []struct {
+		dedup string
+		want  []string
+	}{
+		{"false", []string{"one", "two", "one", "two", "three", "two"}},
+		{"true", []string{"one", "two", "three"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dedup, func(t *testing.T) {
+			setFlag(t, "dedup", tt.dedup)
+			loadPool(t, "one\n\ntwo\n\none\n", "two\n\nthree\n\ntwo\n")
+			if got := poolTexts(); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("pool is %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	loadPool(t, "@author: Someone\n@category: c\na quote\n")
+	t.Cleanup(func() { cachedAt = time.Time{} })
+	tests := []struct {
+		name     string
+		cache    string
+		cachedAt time.Duration // before now
+		url      string
+		want     string
+	}{
+		{"no cache", "0", 0, "/quote", "no-store"},
+		{"fresh", "1h", 0, "/quote", "public, max-age=3600"},
+		{"remaining", "1h", 10 * time.Minute, "/quote", "public, max-age=3000"},
+		{"expired", "1h", 2 * time.Hour, "/quote", "public, max-age=0"},
+		{"fresh override", "1h", 0, "/quote?fresh=1", "no-store"},
+		// random picks other than the cached quote
+		{"maxlen", "1h", 0, "/quote?maxlen=100", "no-store"},
+		{"by author", "1h", 0, "/by/Someone", "no-store"},
+		{"by category", "1h", 0, "/c/c", "no-store"},
+		{"by hash", "1h", 0, "/quote/by-hash/" + pool.Quotes()[0].Hash, "no-store"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "cache", tt.cache)
+			quotesM.Lock()
+			// a second's slack for the request itself
+			cachedAt = time.Now().Add(-tt.cachedAt + time.Second)
+			quotesM.Unlock()
+
+			handler := handleQuote
+			switch {
+			case strings.HasPrefix(tt.url, "/by/"):
+				handler = handleByAuthor
+			case strings.HasPrefix(tt.url, "/c/"):
+				handler = handleByCategory
+			case strings.HasPrefix(tt.url, "/quote/by-hash/"):
+				handler = handleByHash
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest("GET", tt.url, nil))
+			if rec.Code != 200 {
+				t.Fatalf("got %d", rec.Code)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFallback(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer down.Close()
+	files := writeSources(t, "primary\n", "first fallback\n", "second fallback\n")
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+
+	tests := []struct {
+		name      string
+		primary   string
+		fallbacks []string
+		want      string // "" if the reload fails
+	}{
+		{"primary up", files[0], []string{files[1]}, "primary"},
+		{"primary down", down.URL, []string{files[1]}, "first fallback"},
+		{"first fallback down", down.URL, []string{missing, files[2]}, "second fallback"},
+		{"in order", down.URL, []string{files[1], files[2]}, "first fallback"},
+		{"all down", down.URL, []string{missing}, ""},
+		{"no fallback", down.URL, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadPool(t, "previous\n")
+			old := fallbacks
+			fallbacks = tt.fallbacks
+			defer func() { fallbacks, loadedFallback = old, "" }()
+
+			err := reloadQuotes(context.Background(), []string{tt.primary})
+			got := poolTexts()
+			if tt.want == "" {
+				if err == nil || len(got) != 1 || got[0] != "previous" {
+					t.Errorf("got %v with pool %q; want an error, keeping the pool", err, got)
+				}
+				return
+			}
+			if err != nil || len(got) != 1 || got[0] != tt.want {
+				t.Errorf("got %v with pool %q; want %q", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListenSeveral(t *testing.T) {
+	file := writeSources(t, "a quote\n")[0]
+	ports := []string{freePort(t), freePort(t)}
+	d := startDaemon(t, "-port", strings.Join(ports, ","), file)
+	for _, port := range ports {
+		if code, body := fetch(t, "http://127.0.0.1:"+port+"/quote"); code != 200 || body != "a quote\n" {
+			t.Errorf("port %s: got %d %q; want the quote", port, code, body)
+		}
+	}
+
+	d.cmd.Process.Signal(syscall.SIGTERM)
+	if err := d.wait(t); err != nil {
+		t.Fatalf("shut down with %v", err)
+	}
+	for _, port := range ports {
+		if _, err := http.Get("http://127.0.0.1:" + port + "/quote"); err == nil {
+			t.Errorf("port %s still served after shutting down", port)
+		}
+	}
+}
+
+func TestReselectionLog(t *testing.T) {
+	file := writeSources(t, "a rather long quote\nthat gets truncated\n")[0]
+	d := startDaemon(t, "-port", freePort(t), "-verbose", "-cache", "20ms", "-log-preview", "10", file)
+	want := `cached quote reselected: "a rather l…"`
+	for deadline := time.Now().Add(5 * time.Second); !strings.Contains(d.log.String(), want); {
+		if time.Now().After(deadline) {
+			t.Fatalf("log lacks %s", want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSymlinkSwap(t *testing.T) {
+	for _, skip := range []string{"false", "true"} {
+		t.Run("skip unchanged "+skip, func(t *testing.T) {
+			setFlag(t, "skip-unchanged", skip)
+			// same size and mtime, so only the link target differs
+			files := writeSources(t, "old quote\n", "new quote\n")
+			now := time.Now()
+			for _, f := range files {
+				os.Chtimes(f, now, now)
+			}
+			link := filepath.Join(t.TempDir(), "quotes.txt")
+			if err := os.Symlink(files[0], link); err != nil {
+				t.Fatal(err)
+			}
+			loadPool(t, "")
+			if err := reloadQuotes(context.Background(), []string{link}); err != nil {
+				t.Fatal(err)
+			}
+
+			// swapped atomically, the way deploys do
+			tmp := link + ".tmp"
+			if err := os.Symlink(files[1], tmp); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Rename(tmp, link); err != nil {
+				t.Fatal(err)
+			}
+			if err := reloadQuotes(context.Background(), []string{link}); err != nil {
+				t.Fatal(err)
+			}
+			if got := poolTexts(); len(got) != 1 || got[0] != "new quote" {
+				t.Errorf("pool is %q after the swap; want the new target's quote", got)
+			}
+		})
+	}
+}
+
+func TestNoRoot(t *testing.T) {
+	file := writeSources(t, "a quote\n")[0]
+	tests := []struct {
+		flags []string
+		root  int
+	}{
+		{nil, 200},
+		{[]string{"-no-root"}, 404},
+	}
+	for _, tt := range tests {
+		port := freePort(t)
+		startDaemon(t, append(append([]string{"-port", port}, tt.flags...), file)...)
+		for path, want := range map[string]int{"/": tt.root, "/quote": 200, "/debug/pprof/": 404} {
+			if code, _ := fetch(t, "http://127.0.0.1:"+port+path); code != want {
+				t.Errorf("%v: %s answered %d; want %d", tt.flags, path, code, want)
+			}
+		}
+	}
+}
+
+func TestMaxLine(t *testing.T) {
+	files := writeSources(t, strings.Repeat("x", 100000)+"\n")
+	tests := []struct {
+		maxLine string
+		ok      bool
+	}{
+		{"65536", false},
+		{"200000", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.maxLine, func(t *testing.T) {
+			setFlag(t, "max-line", tt.maxLine)
+			loadPool(t, "previous\n")
+			err := reloadQuotes(context.Background(), files)
+			if tt.ok && (err != nil || poolSize() != 1 || len(pool.Quotes()[0].Text) != 100000) {
+				t.Errorf("got %v with %d quotes; want the long quote", err, poolSize())
+			} else if !tt.ok && (err == nil || poolTexts()[0] != "previous") {
+				t.Errorf("got %v with pool %.20q; want an error, keeping the pool", err, poolTexts())
+			}
+		})
+	}
+}
+
+func TestPin(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags map[string]string
+	}{
+		{"random", nil},
+		{"cache", map[string]string{"cache": "1h"}},
+		{"recent window", map[string]string{"recent-window": "2"}},
+		{"sessions", map[string]string{"sessions": "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "pin", "1")
+			for name, value := range tt.flags {
+				setFlag(t, name, value)
+			}
+			loadPool(t, "zero\n\none\n\ntwo\n")
+			for i := 0; i < 20; i++ {
+				rec := httptest.NewRecorder()
+				handleQuote(rec, httptest.NewRequest("GET", "/quote", nil))
+				if rec.Body.String() != "one\n" {
+					t.Fatalf("request %d got %q; want the pinned quote", i, rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestPinRevalidated(t *testing.T) {
+	setFlag(t, "pin", "1")
+	loadPool(t, "zero\n\none\n")
+	if err := reloadQuotes(context.Background(), writeSources(t, "zero\n")); err == nil {
+		t.Error("reloaded a pool too small for the pinned quote")
+	}
+	if got := poolTexts(); len(got) != 2 {
+		t.Errorf("pool is %q; want the previous one kept", got)
+	}
+}
+
+func TestFetchUserAgent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "quote-fetcher/1.0" {
+			w.WriteHeader(403)
+			return
+		}
+		w.Write([]byte("a fetched quote\n"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		agent string
+		ok    bool
+	}{
+		{"", false},
+		{"something else", false},
+		{"quote-fetcher/1.0", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.agent, func(t *testing.T) {
+			setFlag(t, "fetch-user-agent", tt.agent)
+			qs, err := loadQuotesFromURL(context.Background(), srv.URL)
+			if tt.ok && (err != nil || len(qs) != 1) {
+				t.Errorf("got %d quotes, %v; want the quote", len(qs), err)
+			} else if !tt.ok && err == nil {
+				t.Error("fetched with a rejected user agent")
+			}
+		})
+	}
+}
+
+func TestPagination(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Add("Link", `</quotes?page=2>; rel="next"`)
+			w.Write([]byte("page one\n"))
+		case "2":
+			// absolute this time, among other relations
+			w.Header().Add("Link", `<`+srv.URL+`/quotes>; rel="first", <`+srv.URL+`/quotes?page=3>; rel=next`)
+			w.Write([]byte("page two\n\nmore on two\n"))
+		case "3":
+			w.Write([]byte("page three\n"))
+		default:
+			w.WriteHeader(500)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		maxPages string
+		want     []string
+	}{
+		{"1", []string{"page one"}},
+		{"2", []string{"page one", "page two", "more on two"}},
+		{"3", []string{"page one", "page two", "more on two", "page three"}},
+		{"10", []string{"page one", "page two", "more on two", "page three"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.maxPages, func(t *testing.T) {
+			setFlag(t, "max-pages", tt.maxPages)
+			loadPool(t, "")
+			if err := reloadQuotes(context.Background(), []string{srv.URL + "/quotes"}); err != nil {
+				t.Fatal(err)
+			}
+			if got := poolTexts(); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("pool is %q; want %q", got, tt.want)
+			}
+		})
+	}
+
+	setFlag(t, "max-pages", "2")
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Header().Add("Link", `</broken>; rel="next"`)
+			w.Write([]byte("page one\n"))
+			return
+		}
+		w.WriteHeader(500)
+	}))
+	defer broken.Close()
+	if _, err := loadQuotesFromURL(context.Background(), broken.URL); err == nil {
+		t.Error("loaded a source with a broken page")
+	}
+}
+
+func TestPprof(t *testing.T) {
+	file := writeSources(t, "a quote\n")[0]
+	tests := []struct {
+		flags []string
+		want  int
+	}{
+		{nil, 404},
+		{[]string{"-pprof"}, 200},
+		{[]string{"-pprof", "-allow-cidr", "127.0.0.0/8"}, 200},
+		{[]string{"-pprof", "-allow-cidr", "10.0.0.0/8"}, 403},
+		{[]string{"-pprof", "-deny-cidr", "127.0.0.0/8"}, 403},
+	}
+	for _, tt := range tests {
+		port := freePort(t)
+		startDaemon(t, append(append([]string{"-port", port}, tt.flags...), file)...)
+		for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/goroutine", "/debug/pprof/heap", "/debug/pprof/symbol"} {
+			if code, _ := fetch(t, "http://127.0.0.1:"+port+path); code != tt.want {
+				t.Errorf("%v: %s answered %d; want %d", tt.flags, path, code, tt.want)
+			}
+		}
+	}
+}
+
+func TestStatusACL(t *testing.T) {
+	file := writeSources(t, "a quote\n")[0]
+	tests := []struct {
+		flags []string
+		want  int
+	}{
+		{nil, 200},
+		{[]string{"-allow-cidr", "127.0.0.0/8"}, 200},
+		{[]string{"-allow-cidr", "10.0.0.0/8"}, 403},
+		{[]string{"-deny-cidr", "127.0.0.0/8"}, 403},
+	}
+	for _, tt := range tests {
+		port := freePort(t)
+		startDaemon(t, append(append([]string{"-port", port}, tt.flags...), file)...)
+		if code, _ := fetch(t, "http://127.0.0.1:"+port+"/status"); code != tt.want {
+			t.Errorf("%v: /status answered %d; want %d", tt.flags, code, tt.want)
+		}
+	}
+}
+
+func TestLazy(t *testing.T) {
+	// missing at startup, which is fatal without -lazy
+	file := filepath.Join(t.TempDir(), "quotes.txt")
+	port := freePort(t)
+	base := "http://127.0.0.1:" + port
+	startDaemon(t, "-port", port, "-lazy", file)
+
+	poolQuotes := func() string {
+		_, metrics := fetch(t, base+"/metrics")
+		for _, line := range strings.Split(metrics, "\n") {
+			if strings.HasPrefix(line, "httpqotdd_pool_quotes ") {
+				return strings.TrimPrefix(line, "httpqotdd_pool_quotes ")
+			}
+		}
+		return ""
+	}
+	if n := poolQuotes(); n != "0" {
+		t.Errorf("pool has %s quotes before the first request", n)
+	}
+	if code, _ := fetch(t, base+"/health"); code != 200 {
+		t.Errorf("/health answered %d before the first request; want 200", code)
+	}
+	if code, _ := fetch(t, base+"/quote"); code != 503 {
+		t.Errorf("got %d while the source is missing; want 503", code)
+	}
+
+	ioutil.WriteFile(file, []byte("a lazy quote\n"), 0644)
+	if code, body := fetch(t, base+"/quote"); code != 200 || body != "a lazy quote\n" {
+		t.Errorf("first request got %d %q; want the quote", code, body)
+	}
+	if n := poolQuotes(); n != "1" {
+		t.Errorf("pool has %s quotes after the first request", n)
+	}
+}
+
+func TestReloadDelay(t *testing.T) {
+	tests := []struct {
+		reload, backoff string
+		failures        int
+		want            time.Duration
+	}{
+		{"1m", "0", 0, time.Minute},
+		{"1m", "0", 5, time.Minute},
+		{"1m", "10m", 0, time.Minute},
+		{"1m", "10m", 1, 2 * time.Minute},
+		{"1m", "10m", 2, 4 * time.Minute},
+		{"1m", "10m", 3, 8 * time.Minute},
+		{"1m", "10m", 4, 10 * time.Minute},
+		{"1m", "10m", 100, 10 * time.Minute},
+		// a cap below the interval doesn't shorten it
+		{"10m", "1m", 3, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		setFlag(t, "reload", tt.reload)
+		setFlag(t, "reload-backoff", tt.backoff)
+		if got := reloadDelay(tt.failures); got != tt.want {
+			t.Errorf("-reload %s -reload-backoff %s: delay after %d failures is %v; want %v",
+				tt.reload, tt.backoff, tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestMaxLen(t *testing.T) {
+	loadPool(t, "a\n\nbbb\n\nccccc\n\nddddddd\n")
+	tests := []struct {
+		maxlen string
+		status int
+		want   []string
+	}{
+		{"0", 404, nil},
+		{"1", 200, []string{"a"}},
+		{"4", 200, []string{"a", "bbb"}},
+		{"5", 200, []string{"a", "bbb", "ccccc"}},
+		{"100", 200, []string{"a", "bbb", "ccccc", "ddddddd"}},
+		{"-1", 400, nil},
+		{"x", 400, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.maxlen, func(t *testing.T) {
+			seen := map[string]bool{}
+			for i := 0; i < 200; i++ {
+				rec := httptest.NewRecorder()
+				handleQuote(rec, httptest.NewRequest("GET", "/quote?maxlen="+tt.maxlen, nil))
+				if rec.Code != tt.status {
+					t.Fatalf("got %d; want %d", rec.Code, tt.status)
+				}
+				if tt.status == 200 {
+					seen[strings.TrimSuffix(rec.Body.String(), "\n")] = true
+				}
+			}
+			for _, want := range tt.want {
+				if !seen[want] {
+					t.Errorf("never served %q", want)
+				}
+			}
+			if len(seen) != len(tt.want) {
+				t.Errorf("served %v; want only %q", seen, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceCharset(t *testing.T) {
+	tests := []struct {
+		charset string
+		src     string
+		want    string
+	}{
+		{"", "Caf\xc3\xa9\n", "Café"},
+		{"iso-8859-1", "Caf\xe9 cr\xe8me br\xfbl\xe9e\n", "Café crème brûlée"},
+		{"windows-1252", "\x93quoted\x94 \x80\n", "“quoted” €"},
+		{"shift_jis", "\x93\xfa\x96\x7b\x8c\xea\n", "日本語"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.charset, func(t *testing.T) {
+			if tt.charset != "" {
+				enc, err := ianaindex.IANA.Encoding(tt.charset)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sourceCharset = enc
+				defer func() { sourceCharset = nil }()
+			}
+			loadPool(t, tt.src)
+			if got := poolTexts(); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("decoded %q as %q; want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		flags map[string]string
+		err   string // in -strict mode
+	}{
+		{"clean", "one\n\ntwo\n", nil, ""},
+		{"empty quote", "one\n\n\\\n\ntwo\n", nil, "quote 2: empty quote"},
+		{"trimmed empty", "one\n\n   \n\ntwo\n", map[string]string{"trim": "true"}, "quote 2: empty quote"},
+		{"invalid utf-8", "one\n\n\xff\xfe\n\ntwo\n", nil, "quote 2: invalid UTF-8"},
+		{"overlong", "one\n\nthree\n\ntwo\n", map[string]string{"max-quote": "4"}, "quote 2: longer than 4 bytes"},
+	}
+	for _, tt := range tests {
+		for _, strict := range []string{"false", "true"} {
+			t.Run(tt.name+" strict "+strict, func(t *testing.T) {
+				setFlag(t, "strict", strict)
+				for name, value := range tt.flags {
+					setFlag(t, name, value)
+				}
+				qs, err := parseQuotes(context.Background(), strings.NewReader(tt.src))
+				if strict == "true" && tt.err != "" {
+					if err == nil || err.Error() != tt.err {
+						t.Errorf("got %v; want %s", err, tt.err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(qs) != 2 || qs[0].Text != "one" || qs[1].Text != "two" {
+					t.Errorf("loaded %v; want the good quotes", qs)
+				}
+			})
+		}
+	}
+}
+
+func TestIndexTrailer(t *testing.T) {
+	loadPool(t, "zero\n\none\n")
+	setFlag(t, "index-trailer", "true")
+	setFlag(t, "pin", "1")
+	srv := httptest.NewServer(http.HandlerFunc(handleQuote))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/quote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Errorf("transfer encoding %v; want chunked", resp.TransferEncoding)
+	}
+	if _, ok := resp.Trailer["X-Quote-Index"]; !ok {
+		t.Errorf("trailers declared: %v; want X-Quote-Index", resp.Trailer)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	// trailers are only known once the body is read
+	if got := resp.Trailer.Get("X-Quote-Index"); string(body) != "one\n" || got != "1" {
+		t.Errorf("got %q with trailer %q; want the pinned quote with 1", body, got)
+	}
+
+	// with no body to trail, it's a header
+	resp, err = http.Head(srv.URL + "/quote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Quote-Index"); got != "1" {
+		t.Errorf("HEAD got X-Quote-Index %q; want 1", got)
+	}
+}
+
+func TestNumber(t *testing.T) {
+	loadPool(t, "zero\n\none\n\ntwo\n")
+	setFlag(t, "number", "true")
+	for _, pin := range []string{"-1", "0", "1", "2"} {
+		t.Run("pin "+pin, func(t *testing.T) {
+			setFlag(t, "pin", pin)
+			for i := 0; i < 10; i++ {
+				rec := httptest.NewRecorder()
+				handleQuote(rec, httptest.NewRequest("GET", "/quote", nil))
+				var idx int
+				var text string
+				if _, err := fmt.Sscanf(rec.Body.String(), "[%d/3] %s\n", &idx, &text); err != nil {
+					t.Fatalf("%v in %q", err, rec.Body)
+				}
+				if idx < 0 || idx > 2 || text != poolTexts()[idx] {
+					t.Errorf("got %q; want the quote at the index", rec.Body)
+				}
+				if pin != "-1" && strconv.Itoa(idx) != pin {
+					t.Errorf("got %q; want index %s", rec.Body, pin)
+				}
+			}
+		})
+	}
+	// the pool itself is left alone
+	if got := poolTexts(); strings.Join(got, " ") != "zero one two" {
+		t.Errorf("pool is %q", got)
+	}
+}
+
+func TestListenInUse(t *testing.T) {
+	l, err := listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	taken := l.Addr().String()
+	want := "cannot listen on " + taken + ": address already in use"
+	if _, err := listen(taken); err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("got %v; want %s", err, want)
+	}
+
+	// the server gives up on it before serving anything
+	file := writeSources(t, "a quote\n")[0]
+	d := daemonCommand(t, "-port", strconv.Itoa(l.Addr().(*net.TCPAddr).Port), file)
+	d.start(t)
+	if err := d.wait(t); err == nil {
+		t.Fatal("server started on a taken port")
+	}
+	if !strings.Contains(d.log.String(), want) {
+		t.Errorf("logged %q; want %s", d.log.String(), want)
+	}
+}
+
+func TestOutputCharset(t *testing.T) {
+	tests := []struct {
+		charset string
+		path    string
+		accept  string
+		src     string
+		ct      string
+		want    string // the start of the body
+	}{
+		{"", "/quote", "text/plain", "Café\n", "text/plain; charset=utf-8", "Café\n"},
+		{"iso-8859-1", "/quote", "text/plain", "Café crème\n", "text/plain; charset=ISO-8859-1", "Caf\xe9 cr\xe8me\n"},
+		{"iso-8859-1", "/quote", "text/plain", "cost: 5 €\n", "text/plain; charset=ISO-8859-1", "cost: 5 \x1a\n"},
+		{"windows-1252", "/quote", "text/plain", "“quoted” €\n", "text/plain; charset=windows-1252", "\x93quoted\x94 \x80\n"},
+		// JSON is always UTF-8
+		{"iso-8859-1", "/quote", "application/json", "Café\n", "application/json", `{"quote":"Café",`},
+		{"iso-8859-1", "/quote.txt", "text/html", "Café\n", "text/plain; charset=ISO-8859-1", "Caf\xe9\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.charset+" "+tt.path+" "+tt.accept, func(t *testing.T) {
+			if tt.charset != "" {
+				enc, err := ianaindex.IANA.Encoding(tt.charset)
+				if err != nil {
+					t.Fatal(err)
+				}
+				name, err := ianaindex.MIME.Name(enc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				outputCharset, outputName = enc, name
+				defer func() { outputCharset, outputName = nil, "" }()
+			}
+			loadPool(t, tt.src)
+			handler := handleQuote
+			if tt.path == "/quote.txt" {
+				handler = formatHandler("txt")
+			}
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if ct := rec.Header().Get("Content-Type"); ct != tt.ct {
+				t.Errorf("Content-Type %q; want %q", ct, tt.ct)
+			}
+			if !strings.HasPrefix(rec.Body.String(), tt.want) {
+				t.Errorf("got %q; want %q", rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmptyStatus(t *testing.T) {
+	loadPool(t, "")
+	handlers := map[string]http.HandlerFunc{
+		"/quote":     handleQuote,
+		"/quotes":    handleQuotes,
+		"/quote.png": handleQR,
+	}
+	for _, status := range []string{"503", "404", "500", "204"} {
+		t.Run(status, func(t *testing.T) {
+			setFlag(t, "empty-status", status)
+			for path, h := range handlers {
+				rec := httptest.NewRecorder()
+				h(rec, httptest.NewRequest("GET", path, nil))
+				if strconv.Itoa(rec.Code) != status {
+					t.Errorf("%s: got %d; want %s", path, rec.Code, status)
+				}
+			}
+		})
+	}
+
+	for _, status := range []string{"0", "199", "299", "600", "many"} {
+		t.Run("invalid "+status, func(t *testing.T) {
+			d := daemonCommand(t, "-port", freePort(t), "-empty-status", status, writeSources(t, "a quote\n")[0])
+			d.start(t)
+			if err := d.wait(t); err == nil {
+				t.Errorf("started with -empty-status %s", status)
+			}
+		})
+	}
+}
+
+// setRegexp sets re to pattern for the duration of the test, as
+// -include and -exclude are only compiled by parseFlags
+func setRegexp(t *testing.T, re **regexp.Regexp, pattern string) {
+	t.Helper()
+	saved := *re
+	*re = nil
+	if pattern != "" {
+		*re = regexp.MustCompile(pattern)
+	}
+	t.Cleanup(func() { *re = saved })
+}
+
+const profaneQuotes = "a fine quote\n\nTODO: write a quote\n\noh darn it\n\nanother fine one\n"
+
+func TestExclude(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		logged  string
+	}{
+		{"", "a fine quote|TODO: write a quote|oh darn it|another fine one", ""},
+		{"^TODO", "a fine quote|oh darn it|another fine one", "excluded 1 quotes"},
+		{`darn|^TODO`, "a fine quote|another fine one", "excluded 2 quotes"},
+		{"(?i)FINE", "TODO: write a quote|oh darn it", "excluded 2 quotes"},
+		{"nowhere", "a fine quote|TODO: write a quote|oh darn it|another fine one", "excluded 0 quotes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			setRegexp(t, &exclude, tt.pattern)
+			setFlag(t, "verbose", "true")
+			logged := captureLog(t)
+			loadPool(t, profaneQuotes)
+			if got := strings.Join(poolTexts(), "|"); got != tt.want {
+				t.Errorf("pool is %q; want %q", got, tt.want)
+			}
+			if !strings.Contains(logged.String(), tt.logged) {
+				t.Errorf("logged %q; want %q", logged, tt.logged)
+			}
+		})
+	}
+
+	d := daemonCommand(t, "-port", freePort(t), "-exclude", "(unclosed", writeSources(t, "a quote\n")[0])
+	d.start(t)
+	if err := d.wait(t); err == nil || !strings.Contains(d.log.String(), "invalid -exclude pattern") {
+		t.Errorf("exited with %v, logging %q", err, d.log.String())
+	}
+}
+
+func TestInclude(t *testing.T) {
+	tests := []struct {
+		include, exclude string
+		want             string
+		logged           []string
+	}{
+		{"fine", "", "a fine quote|another fine one", []string{"dropped 2 quotes not matching -include"}},
+		{"^nothing", "", "", []string{"dropped 4 quotes not matching -include"}},
+		// the exclusion only sees what was included
+		{"fine|darn", "another|darn", "a fine quote", []string{"dropped 1 quotes not matching -include", "excluded 2 quotes"}},
+		{"fine", "^TODO", "a fine quote|another fine one", []string{"dropped 2 quotes not matching -include", "excluded 0 quotes"}},
+		{"fine", "fine", "", []string{"excluded 2 quotes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.include+" "+tt.exclude, func(t *testing.T) {
+			setRegexp(t, &include, tt.include)
+			setRegexp(t, &exclude, tt.exclude)
+			setFlag(t, "verbose", "true")
+			logged := captureLog(t)
+			loadPool(t, profaneQuotes)
+			if got := strings.Join(poolTexts(), "|"); got != tt.want {
+				t.Errorf("pool is %q; want %q", got, tt.want)
+			}
+			for _, want := range tt.logged {
+				if !strings.Contains(logged.String(), want) {
+					t.Errorf("logged %q; want %q", logged, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		escape string
+		want   string
+	}{
+		{"true", "# literal\n\nC:\\dir"},
+		{"false", "\\# literal\n\\\nC:\\dir"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.escape, func(t *testing.T) {
+			setFlag(t, "escape", tt.escape)
+			loadPool(t, "\\# literal\n\\\nC:\\dir\n")
+			if got := poolTexts(); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("pool is %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCancelSlowFetch(t *testing.T) {
+	// the first fetch answers right away, later ones hang
+	var fetches int32
+	started, cancelled := make(chan struct{}, 10), make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			w.Write([]byte("fetched quote\n"))
+			return
+		}
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+			cancelled <- struct{}{}
+		case <-time.After(20 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	awaitFetch := func(ch chan struct{}, what string) {
+		t.Helper()
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("fetch not %s", what)
+		}
+	}
+
+	t.Run("reload", func(t *testing.T) {
+		loadPool(t, "previous\n")
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			awaitFetch(started, "started")
+			cancel()
+		}()
+		atomic.StoreInt32(&fetches, 1)
+		start := time.Now()
+		if err := reloadQuotes(ctx, []string{srv.URL}); err == nil {
+			t.Error("cancelled reload succeeded")
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("cancelled reload took %v", elapsed)
+		}
+		awaitFetch(cancelled, "cancelled")
+		if got := poolTexts(); len(got) != 1 || got[0] != "previous" {
+			t.Errorf("pool is %q; want the previous one", got)
+		}
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		atomic.StoreInt32(&fetches, 0)
+		d := startDaemon(t, "-port", freePort(t), "-verbose", srv.URL)
+		d.cmd.Process.Signal(syscall.SIGHUP)
+		awaitFetch(started, "started")
+		start := time.Now()
+		d.cmd.Process.Signal(syscall.SIGTERM)
+		if err := d.wait(t); err != nil {
+			t.Errorf("exited with %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("shutdown took %v behind the slow fetch", elapsed)
+		}
+		awaitFetch(cancelled, "cancelled")
+	})
+}
+
+func TestReselectOnReload(t *testing.T) {
+	var many []string
+	for i := 0; i < 50; i++ {
+		many = append(many, "quote "+strconv.Itoa(i))
+	}
+	tests := []struct {
+		reselect string
+		dropped  bool // whether the reload drops the cached quote
+		kept     bool
+	}{
+		{"true", false, false},
+		{"true", true, false},
+		{"false", false, true},
+		{"false", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s dropped %v", tt.reselect, tt.dropped), func(t *testing.T) {
+			setFlag(t, "cache", "1h")
+			setFlag(t, "reselect-on-reload", tt.reselect)
+			setFlag(t, "index-trailer", "true")
+			loadPool(t, strings.Join(many, "\n\n")+"\n")
+			get := func() (string, string) {
+				rec := httptest.NewRecorder()
+				handleQuote(rec, httptest.NewRequest("GET", "/quote", nil))
+				return strings.TrimSuffix(rec.Body.String(), "\n"), rec.Header().Get("X-Quote-Index")
+			}
+			cached, _ := get()
+
+			// the cached quote moves to the front, or is left out
+			reloaded := []string{cached}
+			if tt.dropped {
+				reloaded = []string{"a new quote"}
+			}
+			for _, q := range many {
+				if q != cached {
+					reloaded = append(reloaded, q)
+				}
+			}
+			setFlag(t, "verbose", "true")
+			logged := captureLog(t)
+			if err := reloadQuotes(context.Background(), writeSources(t, strings.Join(reloaded, "\n\n")+"\n")); err != nil {
+				t.Fatal(err)
+			}
+			want := "quotes reloaded; cached quote reselected"
+			if tt.kept {
+				want = "quotes reloaded; cached quote kept"
+			}
+			if !strings.Contains(logged.String(), want) {
+				t.Errorf("logged %q; want %q", logged, want)
+			}
+			got, idx := get()
+			if tt.kept && (got != cached || idx != "0") {
+				t.Errorf("got %q at %s; want %q kept at its new index 0", got, idx, cached)
+			}
+			if tt.dropped && got == cached {
+				t.Errorf("still serving the dropped %q", cached)
+			}
+		})
+	}
+}
+
+func TestKeepLastGood(t *testing.T) {
+	for _, keep := range []string{"false", "true"} {
+		t.Run(keep, func(t *testing.T) {
+			setFlag(t, "keep-last-good", keep)
+			loadPool(t, "")
+			file := writeSources(t, "")[0]
+
+			// serve throughout, counting requests that find no
+			// quote once there was a good pool
+			var armed, failed int32
+			stop, done := make(chan struct{}), make(chan struct{})
+			go func() {
+				defer close(done)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					after := atomic.LoadInt32(&armed) == 1
+					rec := httptest.NewRecorder()
+					handleQuote(rec, httptest.NewRequest("GET", "/quote", nil))
+					if rec.Code != 200 && after {
+						atomic.AddInt32(&failed, 1)
+					}
+				}
+			}()
+
+			kept, held := keep == "true", ""
+			if kept {
+				held = "a quote\n"
+			}
+			steps := []struct {
+				src  string
+				ok   bool   // whether the reload succeeds
+				want string // quote served after it, if any
+			}{
+				// an empty initial pool has nothing to keep
+				{"", true, ""},
+				{"a quote\n", true, "a quote\n"},
+				{"", !kept, held},
+				{"# only a comment\n", !kept, held},
+				{"another quote\n", true, "another quote\n"},
+			}
+			for i, s := range steps {
+				if err := ioutil.WriteFile(file, []byte(s.src), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := reloadQuotes(context.Background(), []string{file}); (err == nil) != s.ok {
+					t.Errorf("step %d: reload returned %v", i, err)
+				}
+				if i == 1 {
+					atomic.StoreInt32(&armed, 1)
+				}
+				time.Sleep(10 * time.Millisecond)
+				rec := httptest.NewRecorder()
+				handleQuote(rec, httptest.NewRequest("GET", "/quote", nil))
+				if s.want == "" && rec.Code != 503 || s.want != "" && rec.Body.String() != s.want {
+					t.Errorf("step %d: got %d %q; want %q", i, rec.Code, rec.Body, s.want)
+				}
+			}
+			close(stop)
+			<-done
+			if n := atomic.LoadInt32(&failed); (n > 0) == kept {
+				t.Errorf("%d requests found no quote", n)
+			}
+		})
+	}
+}
+
+func TestHead(t *testing.T) {
+	loadPool(t, "zero\n\none\n\ntwo\n")
+	tests := []struct {
+		name   string
+		accept string
+		flags  map[string]string
+		want   []string // headers besides X-Quote-Count
+	}{
+		{"text", "", nil, []string{"Content-Type", "Cache-Control"}},
+		{"json", "application/json", nil, []string{"Content-Type", "Cache-Control"}},
+		{"cached", "", map[string]string{"cache": "1h"}, []string{"Content-Type", "Cache-Control"}},
+		{"index", "", map[string]string{"index-trailer": "true"}, []string{"Content-Type", "X-Quote-Index"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.flags {
+				setFlag(t, name, value)
+			}
+			served := fmt.Sprint(serveCounts)
+			serve := func(method string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, "/", nil)
+				req.Header.Set("Accept", tt.accept)
+				rec := httptest.NewRecorder()
+				handleQuote(rec, req)
+				return rec
+			}
+			head := serve("HEAD")
+			if head.Code != 200 || head.Body.Len() != 0 {
+				t.Errorf("got %d %q; want 200 and no body", head.Code, head.Body)
+			}
+			if c := head.Header().Get("X-Quote-Count"); c != "3" {
+				t.Errorf("X-Quote-Count %q; want 3", c)
+			}
+			if got := fmt.Sprint(serveCounts); got != served {
+				t.Errorf("HEAD counted as served: %s", got)
+			}
+
+			get := serve("GET")
+			for _, h := range append(tt.want, "X-Quote-Count") {
+				if head.Header().Get(h) == "" || head.Header().Get(h) != get.Header().Get(h) && h != "X-Quote-Index" {
+					t.Errorf("%s: HEAD %q, GET %q", h, head.Header().Get(h), get.Header().Get(h))
+				}
+			}
+		})
+	}
+}
+
+func TestFirst(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		ok   bool
+	}{
+		{"first", []string{"-first"}, true},
+		{"cache", []string{"-first", "-cache", "1h"}, true},
+		{"recent window", []string{"-first", "-recent-window", "2"}, true},
+		{"pin 0", []string{"-first", "-pin", "0"}, true},
+		{"pin 1", []string{"-first", "-pin", "1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeSources(t, "zero\n\none\n\ntwo\n")[0]
+			port := freePort(t)
+			d := daemonCommand(t, append(append([]string{"-port", port, "-verbose"}, tt.args...), file)...)
+			d.start(t)
+			if !tt.ok {
+				if err := d.wait(t); err == nil {
+					t.Fatal("server started")
+				}
+				return
+			}
+			d.await(t, "READY=1")
+			d.awaitLog(t, "quotes reloaded")
+			get := func(want string) {
+				t.Helper()
+				for i := 0; i < 20; i++ {
+					if code, body := fetch(t, "http://127.0.0.1:"+port+"/"); code != 200 || body != want {
+						t.Fatalf("request %d got %d %q; want %q", i, code, body, want)
+					}
+				}
+			}
+			get("zero\n")
+
+			// the new pool's first quote is served after a reload
+			if err := ioutil.WriteFile(file, []byte("new zero\n\nzero\n\none\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			d.cmd.Process.Signal(syscall.SIGHUP)
+			for deadline := time.Now().Add(10 * time.Second); strings.Count(d.log.String(), "quotes reloaded") < 2; {
+				if time.Now().After(deadline) {
+					t.Fatal("server didn't reload")
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			get("new zero\n")
+		})
+	}
+}
+
+func TestFresh(t *testing.T) {
+	var many []string
+	for i := 0; i < 50; i++ {
+		many = append(many, "quote "+strconv.Itoa(i))
+	}
+	tests := []struct {
+		query string
+		fresh bool
+	}{
+		{"", false},
+		{"?fresh=0", false},
+		{"?fresh=nonsense", false},
+		{"?fresh=1", true},
+		{"?fresh=true", true},
+		{"?peek=1&fresh=1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			setFlag(t, "cache", "1h")
+			loadPool(t, strings.Join(many, "\n\n")+"\n")
+			get := func(query string) string {
+				rec := httptest.NewRecorder()
+				handleQuote(rec, httptest.NewRequest("GET", "/quote"+query, nil))
+				if rec.Code != 200 {
+					t.Fatalf("%s: got %d", query, rec.Code)
+				}
+				return rec.Body.String()
+			}
+			cached := get("")
+
+			others := 0
+			for i := 0; i < 20; i++ {
+				if get(tt.query) != cached {
+					others++
+				}
+			}
+			if fresh := others > 0; fresh != tt.fresh {
+				t.Errorf("%d of 20 requests got another quote than the cached %q", others, cached)
+			}
+			// the cached quote stays as it is
+			if got := get(""); got != cached {
+				t.Errorf("cached quote changed from %q to %q", cached, got)
+			}
+		})
+	}
+}
+
+func TestEmpty204(t *testing.T) {
+	// an empty quote leads, unless it's dropped
+	const src = ",Someone\na quote,Someone else\n"
+	tests := []struct {
+		name     string
+		empty204 string
+		pin      string
+		want     int
+		body     string
+	}{
+		{"empty quote", "true", "0", 204, ""},
+		{"other quote", "true", "1", 200, "a quote"},
+		{"dropped", "false", "0", 200, "a quote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "format", "csv")
+			setFlag(t, "empty-204", tt.empty204)
+			captureLog(t)
+			loadPool(t, src)
+			setFlag(t, "pin", tt.pin)
+			handlers := map[string]http.HandlerFunc{
+				"/quote":      handleQuote,
+				"/quote.txt":  formatHandler("txt"),
+				"/quote.json": formatHandler("json"),
+			}
+			for path, h := range handlers {
+				rec := httptest.NewRecorder()
+				h(rec, httptest.NewRequest("GET", path, nil))
+				if rec.Code != tt.want {
+					t.Errorf("%s: got %d; want %d", path, rec.Code, tt.want)
+				}
+				if tt.want == 204 && rec.Body.Len() != 0 {
+					t.Errorf("%s: 204 with body %q", path, rec.Body)
+				} else if !strings.Contains(rec.Body.String(), tt.body) {
+					t.Errorf("%s: body %q lacks %q", path, rec.Body, tt.body)
+				}
+			}
+		})
+	}
+}
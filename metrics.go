@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// histogram is a Prometheus-style histogram of integer observations
+type histogram struct {
+	bounds []uint64
+	counts []uint64 // per bucket, with a trailing +Inf bucket
+	sum    uint64
+	count  uint64
+}
+
+func newHistogram(bounds ...uint64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *histogram) observe(v uint64) {
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.sum, v)
+	atomic.AddUint64(&h.count, 1)
+}
+
+func (h *histogram) write(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	cumulative := uint64(0)
+	for i, bound := range h.bounds {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		fmt.Fprintf(w, "%s_bucket{le=\"%d\"} %d\n", name, bound, cumulative)
+	}
+	cumulative += atomic.LoadUint64(&h.counts[len(h.bounds)])
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, cumulative)
+	fmt.Fprintf(w, "%s_sum %d\n", name, atomic.LoadUint64(&h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", name, atomic.LoadUint64(&h.count))
+}
+
+var quoteLengths = newHistogram(32, 64, 128, 256, 512, 1024, 2048, 4096)
+
+var (
+	quoteRequests  uint64
+	reloadFailures uint64
+)
+
+// writeCounter writes a counter; the OpenMetrics family name
+// lacks the _total suffix its sample carries
+func writeCounter(w io.Writer, openMetrics bool, name, help string, v uint64) {
+	family := name + "_total"
+	if openMetrics {
+		family = name
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s_total %d\n", family, help, family, name, v)
+}
+
+func writeGauge(w io.Writer, name, help string, v int) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, v)
+}
+
+// handleMetrics serves the Prometheus text format, or OpenMetrics
+// to clients asking for it
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	}
+
+	writeCounter(w, openMetrics, "httpqotdd_quote_requests", "Requests to quote endpoints.", atomic.LoadUint64(&quoteRequests))
+	writeCounter(w, openMetrics, "httpqotdd_reloads", "Successful loads of the quote pool, including the initial one.", uint64(atomic.LoadInt32(&reloads)))
+	writeCounter(w, openMetrics, "httpqotdd_reload_failures", "Failed reloads of the quote pool.", atomic.LoadUint64(&reloadFailures))
+	writeGauge(w, "httpqotdd_pool_quotes", "Quotes in the pool.", poolSize())
+	quoteLengths.write(w, "httpqotdd_quote_length_bytes", "Length of served quotes in bytes.")
+	if openMetrics {
+		io.WriteString(w, "# EOF\n")
+	}
+}
+
+// maxDistribution caps the selections made by /debug/distribution
+const maxDistribution = 1000000
+
+// handleDistribution makes ?n= selections without serving them and
+// reports how often each index in the pool came up
+func handleDistribution(w http.ResponseWriter, r *http.Request) {
+	n := 10000
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 || n > maxDistribution {
+			http.Error(w, "invalid n", 400)
+			return
+		}
+	}
+
+	counts := make([]int, poolSize())
+	for i := 0; i < n; i++ {
+		// the pool may shrink on a reload in between
+		if idx, _ := selectQuote(); idx >= 0 && idx < len(counts) {
+			counts[idx]++
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		N      int   `json:"n"`
+		Counts []int `json:"counts"`
+	}{n, counts})
+}
+
+// handleLengthStats reports the spread of quote lengths in
+// the pool, in bytes
+func handleLengthStats(w http.ResponseWriter, r *http.Request) {
+	lengths := []int{}
+	for _, q := range pool.Quotes() {
+		lengths = append(lengths, len(q.Text))
+	}
+
+	stats := struct {
+		Count  int     `json:"count"`
+		Min    int     `json:"min"`
+		Max    int     `json:"max"`
+		Mean   float64 `json:"mean"`
+		Median float64 `json:"median"`
+	}{Count: len(lengths)}
+	if n := len(lengths); n > 0 {
+		sort.Ints(lengths)
+		sum := 0
+		for _, l := range lengths {
+			sum += l
+		}
+		stats.Min, stats.Max = lengths[0], lengths[n-1]
+		stats.Mean = float64(sum) / float64(n)
+		stats.Median = float64(lengths[(n-1)/2]+lengths[n/2]) / 2
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,242 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []uint64
+		want   string
+	}{
+		{"empty", nil, `h_bucket{le="10"} 0
+h_bucket{le="100"} 0
+h_bucket{le="+Inf"} 0
+h_sum 0
+h_count 0
+`},
+		{"bounds inclusive", []uint64{10, 100}, `h_bucket{le="10"} 1
+h_bucket{le="100"} 2
+h_bucket{le="+Inf"} 2
+h_sum 110
+h_count 2
+`},
+		{"cumulative", []uint64{0, 5, 11, 99, 101, 5000}, `h_bucket{le="10"} 2
+h_bucket{le="100"} 4
+h_bucket{le="+Inf"} 6
+h_sum 5216
+h_count 6
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistogram(10, 100)
+			for _, v := range tt.values {
+				h.observe(v)
+			}
+			var b strings.Builder
+			h.write(&b, "h", "A histogram.")
+			want := "# HELP h A histogram.\n# TYPE h histogram\n" + tt.want
+			if b.String() != want {
+				t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	file := writeSources(t, "one\n\ntwo\n")[0]
+	port := freePort(t)
+	d := startDaemon(t, "-port", port, file)
+	scrape := func(accept string) (string, string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "http://127.0.0.1:"+port+"/metrics", nil)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.Header.Get("Content-Type"), string(body)
+	}
+	// awaitMetrics scrapes until the metrics include all of want
+	awaitMetrics := func(want ...string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			_, body := scrape("")
+			missing := ""
+			for _, w := range want {
+				if !strings.Contains(body, "\n"+w+"\n") {
+					missing = w
+				}
+			}
+			if missing == "" {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("metrics lack %s:\n%s", missing, body)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	awaitMetrics("httpqotdd_quote_requests_total 0", "httpqotdd_reloads_total 1",
+		"httpqotdd_reload_failures_total 0", "httpqotdd_pool_quotes 2")
+	for i := 0; i < 3; i++ {
+		fetch(t, "http://127.0.0.1:"+port+"/quote")
+	}
+	os.Rename(file, file+".gone")
+	d.cmd.Process.Signal(syscall.SIGHUP)
+	awaitMetrics("httpqotdd_quote_requests_total 3", "httpqotdd_reload_failures_total 1")
+	ioutil.WriteFile(file, []byte("one\n\ntwo\n\nthree\n"), 0644)
+	d.cmd.Process.Signal(syscall.SIGHUP)
+	awaitMetrics("httpqotdd_reloads_total 2", "httpqotdd_reload_failures_total 1", "httpqotdd_pool_quotes 3")
+
+	tests := []struct {
+		accept, contentType string
+		family              string // of the request counter
+		eof                 bool
+	}{
+		{"", "text/plain; version=0.0.4", "httpqotdd_quote_requests_total", false},
+		{"application/openmetrics-text; version=1.0.0", "application/openmetrics-text; version=1.0.0; charset=utf-8", "httpqotdd_quote_requests", true},
+	}
+	for _, tt := range tests {
+		contentType, body := scrape(tt.accept)
+		if contentType != tt.contentType {
+			t.Errorf("Content-Type %q; want %q", contentType, tt.contentType)
+		}
+		if want := "# TYPE " + tt.family + " counter\nhttpqotdd_quote_requests_total 3\n"; !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+		if strings.HasSuffix(body, "# EOF\n") != tt.eof {
+			t.Errorf("ends in # EOF: %v; want %v", !tt.eof, tt.eof)
+		}
+	}
+}
+
+func TestQuoteLengthMetric(t *testing.T) {
+	loadPool(t, strings.Repeat("x", 50)+"\n")
+	old := quoteLengths
+	quoteLengths = newHistogram(32, 64, 128)
+	t.Cleanup(func() { quoteLengths = old })
+
+	handleQuote(httptest.NewRecorder(), httptest.NewRequest("GET", "/quote", nil))
+	// nothing is served to HEAD requests
+	handleQuote(httptest.NewRecorder(), httptest.NewRequest("HEAD", "/quote", nil))
+	rec := httptest.NewRecorder()
+	handleMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`httpqotdd_quote_length_bytes_bucket{le="32"} 0`,
+		`httpqotdd_quote_length_bytes_bucket{le="64"} 1`,
+		`httpqotdd_quote_length_bytes_bucket{le="+Inf"} 1`,
+		"httpqotdd_quote_length_bytes_sum 50",
+		"httpqotdd_quote_length_bytes_count 1",
+	} {
+		if !strings.Contains(rec.Body.String(), want+"\n") {
+			t.Errorf("metrics lack %s:\n%s", want, rec.Body)
+		}
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	tests := []struct {
+		query string
+		pin   string
+		code  int
+		n     int
+	}{
+		{"", "-1", 200, 10000},
+		{"?n=1000", "-1", 200, 1000},
+		{"?n=1000", "2", 200, 1000},
+		{"?n=0", "-1", 200, 0},
+		{"?n=-1", "-1", 400, 0},
+		{"?n=1000001", "-1", 400, 0},
+		{"?n=many", "-1", 400, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query+" pin "+tt.pin, func(t *testing.T) {
+			loadPool(t, "zero\n\none\n\ntwo\n\nthree\n")
+			setFlag(t, "pin", tt.pin)
+			served := fmt.Sprint(serveCounts)
+			rec := httptest.NewRecorder()
+			handleDistribution(rec, httptest.NewRequest("GET", "/debug/distribution"+tt.query, nil))
+			if rec.Code != tt.code {
+				t.Fatalf("got %d; want %d", rec.Code, tt.code)
+			}
+			if tt.code != 200 {
+				return
+			}
+			var got struct {
+				N      int
+				Counts []int
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%v in %q", err, rec.Body)
+			}
+			sum := 0
+			for i, c := range got.Counts {
+				sum += c
+				if tt.pin != "-1" && c > 0 && i != 2 {
+					t.Errorf("counts %v; want only the pinned quote", got.Counts)
+				}
+				if tt.pin == "-1" && tt.n >= 1000 && c == 0 {
+					t.Errorf("counts %v; want every quote selected", got.Counts)
+				}
+			}
+			if got.N != tt.n || len(got.Counts) != 4 || sum != tt.n {
+				t.Errorf("got n %d and counts %v; want %d over 4 quotes", got.N, got.Counts, tt.n)
+			}
+			// selecting isn't serving
+			if got := fmt.Sprint(serveCounts); got != served {
+				t.Errorf("served counts went from %s to %s", served, got)
+			}
+		})
+	}
+}
+
+func TestLengthStats(t *testing.T) {
+	tests := []struct {
+		name string
+		srcs []string
+		want string
+	}{
+		{"empty pool", nil, `{"count":0,"min":0,"max":0,"mean":0,"median":0}`},
+		{"one quote", []string{"four\n"}, `{"count":1,"min":4,"max":4,"mean":4,"median":4}`},
+		{"odd count", []string{"a\n\nabc\n\nabcdefgh\n"}, `{"count":3,"min":1,"max":8,"mean":4,"median":3}`},
+		{"even count", []string{"a\n\nab\n\nabcd\n\nabcdefg\n"}, `{"count":4,"min":1,"max":7,"mean":3.5,"median":3}`},
+		{"several sources", []string{"abcdef\n", "ab\n"}, `{"count":2,"min":2,"max":6,"mean":4,"median":4}`},
+		{"multiline", []string{"ab\ncd\n"}, `{"count":1,"min":5,"max":5,"mean":5,"median":5}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.srcs != nil {
+				loadPool(t, tt.srcs...)
+			}
+			rec := httptest.NewRecorder()
+			handleLengthStats(rec, httptest.NewRequest("GET", "/stats/lengths", nil))
+			if rec.Code != 200 {
+				t.Fatalf("got %d", rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type %q; want application/json", ct)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.want {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
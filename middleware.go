@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Middleware wraps a handler with some cross-cutting behaviour
+type Middleware func(http.Handler) http.Handler
+
+// chain composes mws into a single middleware; the first
+// one given is the outermost, so it runs first
+func chain(mws ...Middleware) Middleware {
+	return func(h http.Handler) http.Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+		return h
+	}
+}
+
+// quoteMiddlewares returns the middlewares enabled by
+// the command line for handlers serving quotes
+func quoteMiddlewares() []Middleware {
+	mws := poolMiddlewares()
+	if delay > 0 {
+		mws = append(mws, delayResponse)
+	}
+	return mws
+}
+
+// poolMiddlewares returns the middlewares enabled by the
+// command line for handlers exposing the pool in any way
+func poolMiddlewares() []Middleware {
+	mws := []Middleware{countRequests}
+	if verbose {
+		mws = append(mws, accessLog)
+	}
+	mws = append(mws, aclMiddlewares()...)
+	if lazy {
+		mws = append(mws, lazyLoad)
+	}
+	return mws
+}
+
+// aclMiddlewares returns the middlewares restricting access to
+// -allow-cidr and -deny-cidr, for handlers that don't serve the
+// pool but may give away as much, such as profiles
+func aclMiddlewares() []Middleware {
+	if len(allowCIDR) > 0 || len(denyCIDR) > 0 {
+		return []Middleware{restrictClients}
+	}
+	return nil
+}
+
+func countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint64(&quoteRequests, 1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if logSample >= 1 || rand.Float64() < logSample {
+			log.Printf(`%s "%s %s %s" "%s"`+"\n",
+				r.RemoteAddr, r.Method, r.URL, r.Proto,
+				r.Header.Get("User-Agent"))
+		}
+	})
+}
+
+// delayResponse holds requests for -delay, unless the
+// client goes away first
+func delayResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-r.Context().Done():
+			// never let an aborted delay pass for an empty quote
+			w.WriteHeader(503)
+			return
+		case <-t.C:
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func restrictClients(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !clientAllowed(r.RemoteAddr) {
+			w.WriteHeader(403)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
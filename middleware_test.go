@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogSample(t *testing.T) {
+	tests := []struct {
+		sample   string
+		min, max int // lines logged for 1000 requests
+	}{
+		{"1", 1000, 1000},
+		{"0.1", 50, 150},
+		{"0.01", 1, 30},
+		{"0", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sample, func(t *testing.T) {
+			setFlag(t, "log-sample", tt.sample)
+			logged := captureLog(t)
+			rand.Seed(1)
+
+			h := accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			for i := 0; i < 1000; i++ {
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/quote", nil))
+			}
+			if n := strings.Count(logged.String(), `"GET /quote HTTP/1.1"`); n < tt.min || n > tt.max {
+				t.Errorf("logged %d of 1000 requests; want %d to %d", n, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+				order = append(order, "/"+name)
+			})
+		}
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	})
+
+	tests := []struct {
+		mws  []Middleware
+		want string
+	}{
+		{nil, "handler"},
+		{[]Middleware{mw("a")}, "a handler /a"},
+		{[]Middleware{mw("a"), mw("b"), mw("c")}, "a b c handler /c /b /a"},
+	}
+	for _, tt := range tests {
+		order = nil
+		chain(tt.mws...)(h).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		if got := strings.Join(order, " "); got != tt.want {
+			t.Errorf("ran %q; want %q", got, tt.want)
+		}
+	}
+}
+
+func TestQuoteMiddlewares(t *testing.T) {
+	name := func(mw Middleware) string {
+		return runtime.FuncForPC(reflect.ValueOf(mw).Pointer()).Name()
+	}
+	tests := []struct {
+		flags map[string]string
+		want  []Middleware
+	}{
+		{nil, []Middleware{countRequests}},
+		{map[string]string{"verbose": "true"}, []Middleware{countRequests, accessLog}},
+		{map[string]string{"deny-cidr": "192.0.2.0/24"}, []Middleware{countRequests, restrictClients}},
+		{map[string]string{"delay": "1s", "lazy": "true"}, []Middleware{countRequests, lazyLoad, delayResponse}},
+		{map[string]string{"delay": "1s", "lazy": "true", "verbose": "true", "allow-cidr": "192.0.2.0/24"},
+			[]Middleware{countRequests, accessLog, restrictClients, lazyLoad, delayResponse}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.flags), func(t *testing.T) {
+			allow, deny := allowCIDR, denyCIDR
+			defer func() { allowCIDR, denyCIDR = allow, deny }()
+			for flag, value := range tt.flags {
+				setFlag(t, flag, value)
+			}
+			got, want := []string{}, []string{}
+			for _, mw := range quoteMiddlewares() {
+				got = append(got, name(mw))
+			}
+			for _, mw := range tt.want {
+				want = append(want, name(mw))
+			}
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("middlewares %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestDelayResponse(t *testing.T) {
+	setFlag(t, "delay", "100ms")
+	h := delayResponse(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("a quote\n"))
+	}))
+	tests := []struct {
+		name   string
+		cancel time.Duration // after which the client gives up; 0 = never
+		status int
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"delayed", 0, 200, 100 * time.Millisecond, time.Second},
+		{"cancelled", 10 * time.Millisecond, 503, 10 * time.Millisecond, 90 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.cancel > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.cancel)
+				defer cancel()
+			}
+			rec := httptest.NewRecorder()
+			start := time.Now()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", "/quote", nil).WithContext(ctx))
+			elapsed := time.Since(start)
+			if rec.Code != tt.status {
+				t.Errorf("got %d; want %d", rec.Code, tt.status)
+			}
+			if elapsed < tt.min || elapsed > tt.max {
+				t.Errorf("answered after %v; want %v to %v", elapsed, tt.min, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jktr/httpqotdd/qotd"
+)
+
+// mappedQuotes is a -mmap quote file mapped into memory, along with
+// where each of its quotes is; quotes are parsed from the mapping as
+// they're served, so the pool itself only takes up their offsets
+type mappedQuotes struct {
+	file  string
+	data  []byte
+	spans [][2]int // start and end of each quote in data
+}
+
+var (
+	mapped *mappedQuotes
+	// held for reading while parsing from the mapping, so
+	// that a reload doesn't unmap it under the reader
+	mappedM sync.RWMutex
+)
+
+// mapQuotes maps file and indexes the quotes in it, parsing each
+// once to drop those a reload without -mmap would, e.g. empty ones
+func mapQuotes(ctx context.Context, file string) (*mappedQuotes, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mappedQuotes{file: file}
+	if fi.Size() > 0 {
+		m.data, err = syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// by full hash, as holding on to the texts would defeat the point
+	seen := map[[sha256.Size]byte]bool{}
+	for _, span := range quoteSpans(m.data) {
+		if err := ctx.Err(); err != nil {
+			m.unmap()
+			return nil, err
+		}
+		qs, err := parseSpan(m.data[span[0]:span[1]])
+		if err != nil {
+			m.unmap()
+			return nil, err
+		}
+		if len(qs) != 1 {
+			continue // only metadata or comments
+		}
+		q := qs[0]
+		if checkQuote(q) != "" {
+			continue
+		}
+		if dedup {
+			sum := sha256.Sum256([]byte(q.Text))
+			if seen[sum] {
+				continue
+			}
+			seen[sum] = true
+		}
+		if include != nil && !include.MatchString(q.Text) || exclude != nil && exclude.MatchString(q.Text) {
+			continue
+		}
+		m.spans = append(m.spans, span)
+	}
+	return m, nil
+}
+
+// quoteSpans splits data into the stretches ParsePlain would read
+// a quote from, each with the metadata and comments preceding it.
+// A stretch may hold no quote after all, but never more than one.
+func quoteSpans(data []byte) [][2]int {
+	spans := [][2]int{}
+	start, text, blanks := 0, false, 0
+	for pos := 0; pos < len(data); {
+		end := bytes.IndexByte(data[pos:], '\n')
+		if end < 0 {
+			end = len(data)
+		} else {
+			end += pos + 1
+		}
+		line := bytes.TrimRight(data[pos:end], "\n")
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		pos = end
+
+		switch {
+		case len(line) == 0:
+			if !text {
+				continue
+			}
+			if blanks++; blanks < blankLines {
+				continue
+			}
+			spans = append(spans, [2]int{start, end})
+			start, text, blanks = end, false, 0
+		case line[0] == '#' && !(commentsBetween && text):
+			// skipped by the parser, wherever it falls
+		default:
+			text, blanks = true, 0
+		}
+	}
+	if text {
+		spans = append(spans, [2]int{start, len(data)})
+	}
+	return spans
+}
+
+// parseSpan parses the quote in a stretch of the mapping. It's
+// cheap enough to run for every quote served: there's no
+// -filter-cmd under -mmap, and @image isn't fetched and inlined
+// but left out.
+func parseSpan(data []byte) ([]Quote, error) {
+	qs := []Quote{}
+	err := qotd.ParsePlain(bytes.NewReader(data), plainOptions(), func(q Quote) {
+		if trim {
+			q.Text = strings.TrimSpace(q.Text)
+		}
+		q.Image = ""
+		q.Hash = qotd.Hash(q.Text)
+		qs = append(qs, q)
+	})
+	return qs, err
+}
+
+// quote parses the i-th quote from the mapping; mappedM must be
+// held for reading
+func (m *mappedQuotes) quote(i int) (*Quote, error) {
+	span := m.spans[i]
+	qs, err := parseSpan(m.data[span[0]:span[1]])
+	if err != nil {
+		return nil, err
+	}
+	if len(qs) != 1 {
+		// the file was changed in place rather than replaced
+		return nil, errors.New("quote file changed under the mapping")
+	}
+	qs[0].Source = m.file
+	return &qs[0], nil
+}
+
+func (m *mappedQuotes) unmap() {
+	if m.data != nil {
+		syscall.Munmap(m.data)
+	}
+}
+
+// mappedQuote picks a random quote from the -mmap pool
+func mappedQuote() (int, *Quote) {
+	mappedM.RLock()
+	defer mappedM.RUnlock()
+
+	if mapped == nil || len(mapped.spans) == 0 {
+		return -1, nil
+	}
+	n := len(mapped.spans)
+	pick := func() int { return rand.Intn(n) }
+	idx := avoidRecent(pick(), n, pick)
+	q, err := mapped.quote(idx)
+	if err != nil {
+		log.Println(err)
+		return -1, nil
+	}
+	return idx, q
+}
+
+// mappedQuoteWhere is selectQuoteWhere for the -mmap pool; it
+// parses every quote in the mapping, picking one of those that
+// match at random as it goes
+func mappedQuoteWhere(keep func(*Quote) bool) (int, *Quote) {
+	mappedM.RLock()
+	defer mappedM.RUnlock()
+
+	if mapped == nil {
+		return -1, nil
+	}
+	idx, matches := -1, 0
+	var selection *Quote
+	for i := range mapped.spans {
+		q, err := mapped.quote(i)
+		if err != nil {
+			log.Println(err)
+			return -1, nil
+		}
+		if !keep(q) {
+			continue
+		}
+		if matches++; rand.Intn(matches) == 0 {
+			idx, selection = i, q
+		}
+	}
+	return idx, selection
+}
+
+// mappedSize returns the number of quotes in the -mmap pool
+func mappedSize() int {
+	mappedM.RLock()
+	defer mappedM.RUnlock()
+
+	if mapped == nil {
+		return 0
+	}
+	return len(mapped.spans)
+}
+
+// remapQuotes is reloadQuotes for -mmap: it maps file anew and
+// swaps the mapping in, unmapping the previous one
+func remapQuotes(ctx context.Context, file string) error {
+	m, err := mapQuotes(ctx, file)
+	if err != nil {
+		return err
+	}
+	if keepLastGood && len(m.spans) == 0 && mappedSize() > 0 {
+		m.unmap()
+		return errors.New("reload yielded no quotes; keeping the previous pool")
+	}
+
+	mappedM.Lock()
+	old := mapped
+	mapped = m
+	mappedM.Unlock()
+	// readers are done with the old mapping once they've let go of
+	// mappedM, and the quotes they parsed from it are copies
+	if old != nil {
+		old.unmap()
+	}
+
+	quotesM.Lock()
+	reloadedAt = time.Now()
+	quoteIdx, quote = nextQuoteRaw()
+	notifyWebhook("reload", quoteIdx, quote)
+	quotesM.Unlock()
+	resetRecent()
+	atomic.StoreInt32(&loaded, 1)
+	if verbose {
+		log.Printf("mapped %d quotes from %s\n", len(m.spans), file)
+	}
+	countReload()
+	return nil
+}
@@ -0,0 +1,276 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jktr/httpqotdd/qotd"
+)
+
+// naiveQuotes parses file the way a reload without -mmap does
+func naiveQuotes(t *testing.T, file string) []Quote {
+	t.Helper()
+	data, _ := ioutil.ReadFile(file)
+	qs, err := parseQuotes(context.Background(), bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dedup {
+		qs = dedupQuotes(qs)
+	}
+	if include != nil {
+		qs = matchingQuotes(qs, include, true)
+	}
+	if exclude != nil {
+		qs = matchingQuotes(qs, exclude, false)
+	}
+	for i := range qs {
+		qs[i].Source = file
+	}
+	return qs
+}
+
+func TestMappedQuotes(t *testing.T) {
+	var large strings.Builder
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&large, "@author: Author %d\nquote %d\nsecond line\n\n", i%7, i)
+	}
+
+	tests := []struct {
+		name  string
+		src   string
+		flags map[string]string
+	}{
+		{"empty", "", nil},
+		{"plain", "first\n\nsecond\nof two lines\n\n\nthird", nil},
+		{"metadata", "@author: Someone\n@type: markdown\n@category: c\nattributed\n\n@author: Dangling\n\nunattributed\n\n@author: At the end\n", nil},
+		{"comments", "# heading\n\nfirst\n# dropped\nstill first\n\n# between\nsecond\n", nil},
+		{"comments between", "first\n# kept\n\n# dropped\nsecond\n", map[string]string{"comments-only-between-quotes": "true"}},
+		{"escapes", "\\# not a comment\n\\\nafter a blank\n\n\\\n\nlast\n", nil},
+		{"blank lines", "one\n\nstill one\n\n\ntwo\n\n\n\n\nthree\n", map[string]string{"blank-lines": "2"}},
+		{"crlf", "first\r\n\r\nsecond\r\nline\r\n", nil},
+		{"trim", "  padded  \n\n\tindented\n", map[string]string{"trim": "true"}},
+		{"dedup", "same\n\nother\n\nsame\n", map[string]string{"dedup": "true"}},
+		{"include", "keep this\n\ndrop that\n\nkeep too\n", nil},
+		{"exclude", "keep this\n\ndrop that\n", nil},
+		{"large", large.String(), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.flags {
+				setFlag(t, name, value)
+			}
+			// parsed from their flags on startup only
+			switch tt.name {
+			case "include":
+				include = regexp.MustCompile("keep")
+				defer func() { include = nil }()
+			case "exclude":
+				exclude = regexp.MustCompile("drop")
+				defer func() { exclude = nil }()
+			}
+			file := filepath.Join(t.TempDir(), "quotes.txt")
+			ioutil.WriteFile(file, []byte(tt.src), 0644)
+			want := naiveQuotes(t, file)
+
+			m, err := mapQuotes(context.Background(), file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.unmap()
+			if len(m.spans) != len(want) {
+				t.Fatalf("indexed %d quotes; the naive parse has %d", len(m.spans), len(want))
+			}
+			for i := range want {
+				q, err := m.quote(i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(*q, want[i]) {
+					t.Fatalf("quote %d is %+v; the naive parse has %+v", i, *q, want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMappedServing(t *testing.T) {
+	setFlag(t, "mmap", "true")
+	dir := t.TempDir()
+	file := filepath.Join(dir, "quotes.txt")
+	ioutil.WriteFile(file, []byte("@author: Someone\nthe first\n\nthe second\n"), 0644)
+	t.Cleanup(func() {
+		mappedM.Lock()
+		mapped.unmap()
+		mapped = nil
+		mappedM.Unlock()
+	})
+	reload := func() {
+		t.Helper()
+		if err := reloadQuotes(context.Background(), []string{file}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reload()
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		rec := httptest.NewRecorder()
+		handleQuote(rec, httptest.NewRequest("GET", "/quote", nil))
+		seen[rec.Body.String()] = true
+		if n := rec.Header().Get("X-Quote-Count"); n != "2" {
+			t.Fatalf("X-Quote-Count: %s; want 2", n)
+		}
+	}
+	want := map[string]bool{"the first\n\t-- Someone\n": true, "the second\n": true}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("served %v; want %v", seen, want)
+	}
+
+	// replaced, as files are meant to be under -mmap
+	next := filepath.Join(dir, "next.txt")
+	ioutil.WriteFile(next, []byte("a new quote\n"), 0644)
+	if err := os.Rename(next, file); err != nil {
+		t.Fatal(err)
+	}
+	reload()
+	rec := httptest.NewRecorder()
+	handleQuote(rec, httptest.NewRequest("GET", "/quote", nil))
+	if got := rec.Body.String(); got != "a new quote\n" {
+		t.Errorf("after the reload served %q", got)
+	}
+}
+
+func TestMappedImage(t *testing.T) {
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG"))
+	}))
+	defer srv.Close()
+	setFlag(t, "mmap", "true")
+	file := writeSources(t, "@image: "+srv.URL+"/quote.png\nwith an image\n")[0]
+	t.Cleanup(func() {
+		mappedM.Lock()
+		mapped.unmap()
+		mapped = nil
+		mappedM.Unlock()
+	})
+
+	if err := reloadQuotes(context.Background(), []string{file}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		formatHandler("html")(rec, httptest.NewRequest("GET", "/quote.html", nil))
+		if rec.Code != 200 || !strings.Contains(rec.Body.String(), "with an image") {
+			t.Fatalf("got %d %q", rec.Code, rec.Body)
+		}
+		if strings.Contains(rec.Body.String(), "<img") {
+			t.Errorf("served an image: %q", rec.Body)
+		}
+	}
+	if fetches != 0 {
+		t.Errorf("fetched the image %d times", fetches)
+	}
+}
+
+func TestMappedFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		ok   bool
+	}{
+		{"plain", nil, true},
+		{"trim", []string{"-trim"}, true},
+		{"filter", []string{"-filter-cmd", "cat"}, false},
+		{"pin", []string{"-pin", "0"}, false},
+		{"sample", []string{"-sample", "1"}, false},
+		{"csv", []string{"-format", "csv"}, false},
+		{"fallback", []string{"-fallback", "/dev/null"}, false},
+		{"submissions", []string{"-accept-submissions"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeSources(t, "a quote\n")[0]
+			port := freePort(t)
+			d := daemonCommand(t, append(append([]string{"-port", port, "-mmap"}, tt.args...), file)...)
+			d.start(t)
+			if !tt.ok {
+				if err := d.wait(t); err == nil {
+					t.Fatal("server started")
+				}
+				return
+			}
+			d.await(t, "READY=1")
+			if code, body := fetch(t, "http://127.0.0.1:"+port+"/"); code != 200 || body != "a quote\n" {
+				t.Errorf("got %d %q", code, body)
+			}
+		})
+	}
+}
+
+func TestMappedLookups(t *testing.T) {
+	setFlag(t, "mmap", "true")
+	file := writeSources(t, "@author: Someone\n@category: wisdom\na rather long quote\n\n@author: Someone else\nshort\n")[0]
+	t.Cleanup(func() {
+		mappedM.Lock()
+		mapped.unmap()
+		mapped = nil
+		mappedM.Unlock()
+	})
+	if err := reloadQuotes(context.Background(), []string{file}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		handler func(http.ResponseWriter, *http.Request)
+		want    int
+		body    string
+	}{
+		{"/by/Someone", handleByAuthor, 200, "a rather long quote\n\t-- Someone\n"},
+		{"/by/Someone%20else", handleByAuthor, 200, "short\n\t-- Someone else\n"},
+		{"/by/Nobody", handleByAuthor, 404, ""},
+		{"/c/wisdom", handleByCategory, 200, "a rather long quote\n\t-- Someone\n"},
+		{"/c/folly", handleByCategory, 404, ""},
+		{"/quote/by-hash/" + qotd.Hash("short"), handleByHash, 200, "short\n\t-- Someone else\n"},
+		{"/quote/by-hash/00000000", handleByHash, 404, ""},
+		{"/quote?maxlen=5", handleQuote, 200, "short\n\t-- Someone else\n"},
+		{"/quote?maxlen=4", handleQuote, 404, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest("GET", tt.path, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("got %d; want %d", rec.Code, tt.want)
+			}
+			if tt.want == 200 && rec.Body.String() != tt.body {
+				t.Errorf("got %q; want %q", rec.Body, tt.body)
+			}
+		})
+	}
+
+	t.Run("rich json", func(t *testing.T) {
+		setFlag(t, "rich-json", "true")
+		rec := httptest.NewRecorder()
+		formatHandler("json")(rec, httptest.NewRequest("GET", "/quote.json", nil))
+		if !strings.Contains(rec.Body.String(), `"pool":2`) {
+			t.Errorf("got %q; want the pool of 2", rec.Body)
+		}
+	})
+}
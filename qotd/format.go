@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package qotd
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Format renders quotes as one media type
+type Format struct {
+	ContentType string
+	Write       func(w io.Writer, q Quote) error
+	WriteList   func(w io.Writer, qs []Quote) error
+
+	// WriteError, if set, renders an error body; otherwise
+	// errors are reported by status code alone
+	WriteError func(w io.Writer, msg string) error
+
+	// raw formats write the quote text as is, so
+	// a quote's own @type may override ContentType
+	Raw bool
+}
+
+// Formats are the formats quotes can be served in, by name;
+// programs may register their own along with their MediaTypes
+var Formats = map[string]Format{
+	"txt": {
+		ContentType: "text/plain; charset=utf-8",
+		Raw:         true,
+		Write:       WriteText,
+		WriteList: func(w io.Writer, qs []Quote) error {
+			for i, q := range qs {
+				if i > 0 {
+					io.WriteString(w, "\n")
+				}
+				if err := WriteText(w, q); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	"json": {
+		ContentType: "application/json",
+		Write: func(w io.Writer, q Quote) error {
+			return json.NewEncoder(w).Encode(q)
+		},
+		WriteList: func(w io.Writer, qs []Quote) error {
+			return json.NewEncoder(w).Encode(qs)
+		},
+		WriteError: func(w io.Writer, msg string) error {
+			return json.NewEncoder(w).Encode(struct {
+				Error string `json:"error"`
+			}{msg})
+		},
+	},
+}
+
+// MediaTypes maps the media types clients may accept
+// to the names of the Formats serving them
+var MediaTypes = map[string]string{
+	"text/plain":       "txt",
+	"text/*":           "txt",
+	"*/*":              "txt",
+	"application/json": "json",
+}
+
+// WriteText writes q as plain text, followed by its author
+func WriteText(w io.Writer, q Quote) error {
+	text := q.Text + "\n"
+	if q.Author != "" {
+		text += "\t-- " + q.Author + "\n"
+	}
+	_, err := io.WriteString(w, text)
+	return err
+}
+
+// Negotiate picks the format best matching the Accept
+// header, falling back to plain text
+func Negotiate(r *http.Request) Format {
+	best, bestQ := "txt", 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		params := strings.Split(part, ";")
+		q := 1.0
+		for _, p := range params[1:] {
+			if v := strings.TrimSpace(p); strings.HasPrefix(v, "q=") {
+				if f, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		name, ok := MediaTypes[strings.TrimSpace(params[0])]
+		if _, known := Formats[name]; ok && known && q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return Formats[best]
+}
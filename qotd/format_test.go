@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package qotd
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "text/plain; charset=utf-8"},
+		{"*/*", "text/plain; charset=utf-8"},
+		{"application/json", "application/json"},
+		{"text/plain, application/json", "text/plain; charset=utf-8"},
+		{"text/plain;q=0.2, application/json", "application/json"},
+		{"application/json;q=0, text/*;q=0.1", "text/plain; charset=utf-8"},
+		{"application/json ; q=0.8 , text/plain ; q=0.7", "application/json"},
+		{"application/json;q=bogus", "application/json"},
+		{"image/png", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		if got := Negotiate(req).ContentType; got != tt.want {
+			t.Errorf("Negotiate(%q) = %q; want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	tests := []struct {
+		q    Quote
+		want string
+	}{
+		{Quote{Text: "a quote"}, "a quote\n"},
+		{Quote{Text: "a quote", Author: "Someone"}, "a quote\n\t-- Someone\n"},
+		{Quote{Text: "two\nlines"}, "two\nlines\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := WriteText(&buf, tt.q); err != nil || buf.String() != tt.want {
+			t.Errorf("WriteText(%+v) = %q, %v; want %q", tt.q, buf.String(), err, tt.want)
+		}
+	}
+}
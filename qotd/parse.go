@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package qotd
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// ParseOptions adjusts how ParsePlain reads the plain format
+type ParseOptions struct {
+	// MaxLine is the longest line in bytes; 0 means bufio's default
+	MaxLine int
+
+	// BlankLines is how many consecutive blank lines separate
+	// quotes; fewer are part of the quote. 0 means 1.
+	BlankLines int
+
+	// CommentsBetween keeps # lines inside a quote as its text
+	CommentsBetween bool
+
+	// Categories reads [name] lines between quotes as the
+	// header of a category section
+	Categories bool
+
+	// NoEscape passes lines through verbatim, rather than reading
+	// a leading \# as a literal # and a lone \ as an empty line
+	NoEscape bool
+}
+
+// Parse reads quotes in the plain format, dropping empty ones
+func Parse(r io.Reader, opts ParseOptions) ([]Quote, error) {
+	qs := []Quote{}
+	err := ParsePlain(r, opts, func(q Quote) {
+		if q.Text != "" {
+			q.Hash = Hash(q.Text)
+			qs = append(qs, q)
+		}
+	})
+	return qs, err
+}
+
+// ParsePlain reads quotes in the plain format, passing each to add
+// as is; it's up to add to check and hash them. Metadata lines
+// apply to the quote directly following them, and are dropped
+// if a blank line or the end of input comes first.
+func ParsePlain(r io.Reader, opts ParseOptions, add func(Quote)) error {
+	blankLines := opts.BlankLines
+	if blankLines < 1 {
+		blankLines = 1
+	}
+
+	acc := []string{}
+	q := Quote{}
+	blanks := 0 // blank lines seen since the last line of acc
+	section := ""
+
+	scan := bufio.NewScanner(r)
+	if opts.MaxLine > 0 {
+		scan.Buffer(nil, opts.MaxLine)
+	}
+	for scan.Scan() {
+		line := scan.Text()
+		if strings.HasPrefix(line, "#") && !(opts.CommentsBetween && len(acc) > 0) {
+			continue
+		}
+
+		if len(acc) == 0 && parseFrontMatter(line, &q) {
+			continue
+		}
+		if opts.Categories && len(acc) == 0 && len(line) > 2 &&
+			line[0] == '[' && line[len(line)-1] == ']' {
+			section = line[1 : len(line)-1]
+			q.Category = section
+			continue
+		}
+
+		if !opts.NoEscape && strings.HasPrefix(line, "\\#") {
+			line = line[1:]
+		}
+
+		if len(line) > 0 {
+			// fewer than BlankLines blanks belong to the quote
+			for ; blanks > 0; blanks-- {
+				acc = append(acc, "")
+			}
+			if !opts.NoEscape && line == "\\" {
+				line = ""
+			}
+			acc = append(acc, line)
+		} else if len(acc) > 0 {
+			if blanks++; blanks < blankLines {
+				continue
+			}
+			q.Text = strings.Join(acc, "\n")
+			add(q)
+			acc = []string{}
+			q = Quote{Category: section}
+			blanks = 0
+		} else {
+			// metadata not followed by any text belongs to
+			// no quote, rather than the next one
+			q = Quote{Category: section}
+		}
+	}
+
+	if err := scan.Err(); err != nil {
+		return err
+	}
+
+	if len(acc) > 0 {
+		q.Text = strings.Join(acc, "\n")
+		add(q)
+	}
+	return nil
+}
+
+// parseFrontMatter recognizes "@key: value" metadata lines at
+// the start of a quote; unknown keys are left as quote text
+func parseFrontMatter(line string, q *Quote) bool {
+	if !strings.HasPrefix(line, "@") {
+		return false
+	}
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return false
+	}
+
+	value := strings.TrimSpace(line[i+1:])
+	switch line[1:i] {
+	case "author":
+		q.Author = value
+	case "type":
+		q.Type = value
+	case "image":
+		q.Image = value
+	case "category":
+		q.Category = value
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package qotd
+
+import (
+	"strings"
+	"testing"
+)
+
+// FuzzParseQuotes checks that no input makes Parse panic or hand
+// back empty or unhashed quotes; seeds are in testdata/fuzz
+func FuzzParseQuotes(f *testing.F) {
+	f.Add("a quote\n\n@author: Someone\nanother\n", uint8(1), uint8(0))
+	f.Fuzz(func(t *testing.T, data string, blankLines, flags uint8) {
+		opts := ParseOptions{
+			BlankLines:      int(blankLines % 4),
+			CommentsBetween: flags&1 != 0,
+			Categories:      flags&2 != 0,
+			NoEscape:        flags&4 != 0,
+		}
+		qs, err := Parse(strings.NewReader(data), opts)
+		if err != nil {
+			// only overlong lines fail, and none fit in a test input
+			t.Fatalf("Parse(%q) failed: %v", data, err)
+		}
+		if qs == nil {
+			t.Fatalf("Parse(%q) returned nil", data)
+		}
+
+		nonEmpty := 0
+		ParsePlain(strings.NewReader(data), opts, func(q Quote) {
+			if q.Text != "" {
+				nonEmpty++
+			}
+		})
+		if len(qs) != nonEmpty {
+			t.Errorf("Parse(%q) returned %d quotes; ParsePlain gave %d non-empty ones", data, len(qs), nonEmpty)
+		}
+		for _, q := range qs {
+			switch {
+			case q.Text == "":
+				t.Errorf("Parse(%q) returned an empty quote: %+v", data, q)
+			case q.Hash != Hash(q.Text):
+				t.Errorf("Parse(%q) returned %+v with hash %q; want %q", data, q, q.Hash, Hash(q.Text))
+			case !strings.Contains(data, strings.SplitN(q.Text, "\n", 2)[0]):
+				t.Errorf("Parse(%q) made up quote %q", data, q.Text)
+			}
+		}
+	})
+}
@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package qotd
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseLongLines(t *testing.T) {
+	long := strings.Repeat("x", bufio.MaxScanTokenSize+1)
+	tests := []struct {
+		name    string
+		maxLine int
+		ok      bool
+	}{
+		{"default", 0, false},
+		{"too small", bufio.MaxScanTokenSize, false},
+		{"large enough", 2 * bufio.MaxScanTokenSize, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qs, err := Parse(strings.NewReader("before\n\n"+long+"\n\nafter\n"), ParseOptions{MaxLine: tt.maxLine})
+			if !tt.ok {
+				if err != bufio.ErrTooLong {
+					t.Errorf("got %v; want %v", err, bufio.ErrTooLong)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := texts(qs); len(got) != 3 || got[1] != long {
+				t.Errorf("parsed %d quotes, lacking the long one", len(got))
+			}
+		})
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	const src = "# header\n" +
+		"  /\\_/\\\n" +
+		"# ( o.o )\n" +
+		"\n" +
+		"# between quotes\n" +
+		"second\n" +
+		"\\# escaped\n" +
+		"#\n"
+	tests := []struct {
+		name string
+		opts ParseOptions
+		want []string
+	}{
+		{"default", ParseOptions{}, []string{"  /\\_/\\", "second\n# escaped"}},
+		{"between", ParseOptions{CommentsBetween: true}, []string{"  /\\_/\\\n# ( o.o )", "second\n# escaped\n#"}},
+		{"no escape", ParseOptions{CommentsBetween: true, NoEscape: true}, []string{"  /\\_/\\\n# ( o.o )", "second\n\\# escaped\n#"}},
+		// the blank line is still inside the quote
+		{"blank lines", ParseOptions{CommentsBetween: true, BlankLines: 2}, []string{"  /\\_/\\\n# ( o.o )\n\n# between quotes\nsecond\n# escaped\n#"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qs, err := Parse(strings.NewReader(src), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := texts(qs); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBlankLines(t *testing.T) {
+	const src = "\n\none\n\nstill one\n\n\ntwo\n \n\n\n\n\nthree\n\n"
+	tests := []struct {
+		blankLines int
+		want       []string
+	}{
+		{0, []string{"one", "still one", "two\n ", "three"}},
+		{1, []string{"one", "still one", "two\n ", "three"}},
+		{2, []string{"one\n\nstill one", "two\n ", "three"}},
+		{3, []string{"one\n\nstill one\n\n\ntwo\n ", "three"}},
+		{10, []string{"one\n\nstill one\n\n\ntwo\n \n\n\n\n\nthree"}},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.blankLines), func(t *testing.T) {
+			qs, err := Parse(strings.NewReader(src), ParseOptions{BlankLines: tt.blankLines})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := texts(qs); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCategories(t *testing.T) {
+	const src = "uncategorized\n\n" +
+		"[wisdom]\n" +
+		"first wise\n\n" +
+		"second wise\n" +
+		"[not a header]\n\n" +
+		"@category: jokes\n" +
+		"a joke\n\n" +
+		"[jokes]\n\n" +
+		"[]\n\n" +
+		"another joke\n"
+	tests := []struct {
+		name       string
+		categories bool
+		want       []string // text@category
+	}{
+		{"off", false, []string{"uncategorized@", "[wisdom]\nfirst wise@", "second wise\n[not a header]@", "a joke@jokes", "[jokes]@", "[]@", "another joke@"}},
+		{"on", true, []string{"uncategorized@", "first wise@wisdom", "second wise\n[not a header]@wisdom", "a joke@jokes", "[]@jokes", "another joke@jokes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qs, err := Parse(strings.NewReader(src), ParseOptions{Categories: tt.categories})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, q := range qs {
+				got = append(got, q.Text+"@"+q.Category)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEscapes(t *testing.T) {
+	const src = "\\# not a comment\nC:\\path\\ \n\\\nafter a blank\n\n\\\\# two\n"
+	tests := []struct {
+		name     string
+		noEscape bool
+		want     []string
+	}{
+		{"escape", false, []string{"# not a comment\nC:\\path\\ \n\nafter a blank", "\\\\# two"}},
+		{"verbatim", true, []string{"\\# not a comment\nC:\\path\\ \n\\\nafter a blank", "\\\\# two"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qs, err := Parse(strings.NewReader(src), ParseOptions{NoEscape: tt.noEscape})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := texts(qs); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
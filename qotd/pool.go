@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package qotd
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Pool is a set of quotes safe for concurrent use. Reading it
+// takes no locks; changes are serialized and copy on write.
+type Pool struct {
+	// Weigh, if set, gives the relative chance of each of the
+	// quotes to be picked; they're picked uniformly otherwise
+	Weigh func(qs []Quote) []float64
+
+	snap atomic.Pointer[Snapshot]
+	m    sync.Mutex // held while changing snap
+}
+
+// Snapshot is the content of a Pool at some point. Pools replace
+// their snapshot on every change rather than modifying it, so
+// it, and pointers into its Quotes, stay valid indefinitely.
+type Snapshot struct {
+	Quotes []Quote
+
+	// cumulative selection weights; nil when uniform
+	cum []float64
+}
+
+// Pick returns the index of a random quote, or -1 if there are none
+func (s *Snapshot) Pick() int {
+	switch {
+	case len(s.Quotes) == 0:
+		return -1
+	case s.cum == nil:
+		return rand.Intn(len(s.Quotes))
+	}
+	return sort.SearchFloat64s(s.cum, rand.Float64()*s.cum[len(s.cum)-1])
+}
+
+// Snapshot returns the current content of the pool; it's
+// never nil, but may be empty
+func (p *Pool) Snapshot() *Snapshot {
+	if s := p.snap.Load(); s != nil {
+		return s
+	}
+	return &Snapshot{}
+}
+
+// snapshot builds a snapshot of qs, which it takes over
+func (p *Pool) snapshot(qs []Quote) *Snapshot {
+	s := &Snapshot{Quotes: qs}
+	if p.Weigh == nil || len(qs) == 0 {
+		return s
+	}
+	weights := p.Weigh(qs)
+	if len(weights) != len(qs) {
+		return s
+	}
+	s.cum = make([]float64, len(qs))
+	total := 0.0
+	for i, w := range weights {
+		if w > 0 {
+			total += w
+		}
+		s.cum[i] = total
+	}
+	if total <= 0 {
+		s.cum = nil
+	}
+	return s
+}
+
+// Set replaces the quotes in the pool
+func (p *Pool) Set(qs []Quote) {
+	qs = append([]Quote(nil), qs...)
+	p.m.Lock()
+	p.snap.Store(p.snapshot(qs))
+	p.m.Unlock()
+}
+
+// Add adds quotes to the pool
+func (p *Pool) Add(qs ...Quote) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	// copy on write, as snapshots are handed out
+	old := p.Snapshot().Quotes
+	grown := make([]Quote, len(old), len(old)+len(qs))
+	copy(grown, old)
+	p.snap.Store(p.snapshot(append(grown, qs...)))
+}
+
+// AddQuotes adds quotes given by their text, skipping empty ones
+func (p *Pool) AddQuotes(texts []string) {
+	qs := make([]Quote, 0, len(texts))
+	for _, text := range texts {
+		if text != "" {
+			qs = append(qs, Quote{Text: text, Hash: Hash(text)})
+		}
+	}
+	p.Add(qs...)
+}
+
+// Quotes returns the quotes in the pool, which mustn't be modified
+func (p *Pool) Quotes() []Quote {
+	return p.Snapshot().Quotes
+}
+
+func (p *Pool) Len() int {
+	return len(p.Snapshot().Quotes)
+}
+
+// Random picks a quote and its index at random; ok is false
+// if the pool is empty
+func (p *Pool) Random() (idx int, q Quote, ok bool) {
+	s := p.Snapshot()
+	if idx = s.Pick(); idx < 0 {
+		return -1, Quote{}, false
+	}
+	return idx, s.Quotes[idx], true
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package qotd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func texts(qs []Quote) []string {
+	ts := []string{}
+	for _, q := range qs {
+		ts = append(ts, q.Text)
+	}
+	return ts
+}
+
+func TestPool(t *testing.T) {
+	tests := []struct {
+		name string
+		fill func(p *Pool)
+		want []string
+	}{
+		{"empty", func(p *Pool) {}, []string{}},
+		{"set", func(p *Pool) {
+			p.Set([]Quote{{Text: "a"}, {Text: "b"}})
+		}, []string{"a", "b"}},
+		{"set replaces", func(p *Pool) {
+			p.Set([]Quote{{Text: "a"}})
+			p.Set([]Quote{{Text: "b"}})
+		}, []string{"b"}},
+		{"add", func(p *Pool) {
+			p.Set([]Quote{{Text: "a"}})
+			p.Add(Quote{Text: "b"}, Quote{Text: "c"})
+		}, []string{"a", "b", "c"}},
+		{"add quotes", func(p *Pool) {
+			p.AddQuotes([]string{"a", "", "b"})
+		}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Pool
+			tt.fill(&p)
+			if got := texts(p.Quotes()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Quotes() = %q; want %q", got, tt.want)
+			}
+			if p.Len() != len(tt.want) {
+				t.Errorf("Len() = %d; want %d", p.Len(), len(tt.want))
+			}
+			idx, q, ok := p.Random()
+			if ok != (len(tt.want) > 0) {
+				t.Fatalf("Random() ok = %v with %d quotes", ok, len(tt.want))
+			}
+			if ok && q.Text != tt.want[idx] {
+				t.Errorf("Random() = %d, %q; want %q at %d", idx, q.Text, tt.want[idx], idx)
+			}
+		})
+	}
+}
+
+func TestAddQuotesHashes(t *testing.T) {
+	var p Pool
+	p.AddQuotes([]string{"a"})
+	if q := p.Quotes()[0]; q.Hash != Hash("a") {
+		t.Errorf("added quote has hash %q; want %q", q.Hash, Hash("a"))
+	}
+}
+
+func TestSnapshotUnchanged(t *testing.T) {
+	var p Pool
+	qs := []Quote{{Text: "a"}}
+	p.Set(qs)
+	s := p.Snapshot()
+	held := &s.Quotes[0]
+
+	qs[0].Text = "changed by the caller"
+	p.Add(Quote{Text: "b"})
+	p.Set([]Quote{{Text: "c"}})
+	if got := texts(s.Quotes); !reflect.DeepEqual(got, []string{"a"}) || held.Text != "a" {
+		t.Errorf("snapshot changed to %q", got)
+	}
+	if p.Snapshot() == s {
+		t.Error("Set kept the old snapshot")
+	}
+}
+
+func TestPick(t *testing.T) {
+	qs := []Quote{{Text: "a"}, {Text: "b"}, {Text: "c"}}
+	tests := []struct {
+		name  string
+		weigh func([]Quote) []float64
+		want  []bool // whether each quote may come up
+	}{
+		{"uniform", nil, []bool{true, true, true}},
+		{"weighted", func([]Quote) []float64 { return []float64{0, 1, 0} }, []bool{false, true, false}},
+		{"zero weights are uniform", func([]Quote) []float64 { return []float64{0, 0, 0} }, []bool{true, true, true}},
+		{"mismatched weights are uniform", func([]Quote) []float64 { return []float64{1} }, []bool{true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Pool{Weigh: tt.weigh}
+			p.Set(qs)
+			seen := make([]bool, len(qs))
+			for i := 0; i < 1000; i++ {
+				seen[p.Snapshot().Pick()] = true
+			}
+			if !reflect.DeepEqual(seen, tt.want) {
+				t.Errorf("picked %v; want %v", seen, tt.want)
+			}
+		})
+	}
+
+	if idx := (&Snapshot{}).Pick(); idx != -1 {
+		t.Errorf("empty snapshot picked %d; want -1", idx)
+	}
+}
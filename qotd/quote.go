@@ -0,0 +1,33 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package qotd parses and serves quotes of the day. It is the core
+// of the httpqotdd server, for use by programs embedding one.
+package qotd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Quote is a single entry in the quote pool
+type Quote struct {
+	Text   string `json:"quote"`
+	Author string `json:"author,omitempty"`
+	Hash   string `json:"hash"`
+	Type   string `json:"type,omitempty"`
+
+	Category string `json:"category,omitempty"`
+
+	// data URI of the quote's @image, for HTML output only
+	Image string `json:"-"`
+
+	// source the quote was loaded from, if any
+	Source string `json:"-"`
+}
+
+// Hash is a short content hash identifying
+// a quote across reloads
+func Hash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:4])
+}
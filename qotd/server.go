@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package qotd
+
+import (
+	"net/http"
+	"os"
+)
+
+// Config configures a Server
+type Config struct {
+	// Sources are quote files in the plain format, loaded by
+	// NewServer; quotes may also be added later with AddQuotes
+	Sources []string
+
+	Parse ParseOptions
+}
+
+// Server is an http.Handler serving random quotes from its pool,
+// in whichever of the Formats the client prefers
+type Server struct {
+	Pool
+}
+
+// NewServer returns a Server with the quotes of cfg.Sources
+func NewServer(cfg Config) (*Server, error) {
+	s := &Server{}
+	for _, source := range cfg.Sources {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		qs, err := Parse(f, cfg.Parse)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		for i := range qs {
+			qs[i].Source = source
+		}
+		s.Add(qs...)
+	}
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f := Negotiate(r)
+	w.Header().Set("Cache-Control", "no-store")
+	_, q, ok := s.Random()
+	if !ok {
+		if f.WriteError == nil {
+			http.Error(w, "no quotes available", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", f.ContentType)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		f.WriteError(w, "no quotes available")
+		return
+	}
+
+	w.Header().Set("Content-Type", f.ContentType)
+	f.Write(w, q)
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package qotd
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewServer(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "quotes.txt")
+	ioutil.WriteFile(file, []byte("@author: Someone\nfrom a file\n"), 0644)
+
+	if _, err := NewServer(Config{Sources: []string{filepath.Join(dir, "missing")}}); err == nil {
+		t.Error("NewServer succeeded with a missing source")
+	}
+
+	srv, err := NewServer(Config{Sources: []string{file}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qs := srv.Quotes()
+	if len(qs) != 1 || qs[0].Text != "from a file" || qs[0].Author != "Someone" || qs[0].Source != file {
+		t.Errorf("NewServer loaded %+v", qs)
+	}
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		texts   []string
+		accept  string
+		status  int
+		ctype   string
+		content string
+	}{
+		{"text", []string{"a quote"}, "", 200, "text/plain; charset=utf-8", "a quote\n"},
+		{"json", []string{"a quote"}, "application/json", 200, "application/json", `"quote":"a quote"`},
+		{"prefers text", []string{"a quote"}, "application/json;q=0.5, text/plain", 200, "text/plain; charset=utf-8", "a quote\n"},
+		{"prefers json", []string{"a quote"}, "text/plain;q=0.1, application/json;q=0.9", 200, "application/json", `"quote":"a quote"`},
+		{"unknown type", []string{"a quote"}, "image/png", 200, "text/plain; charset=utf-8", "a quote\n"},
+		{"empty", nil, "", 503, "text/plain; charset=utf-8", "no quotes available"},
+		{"empty json", nil, "application/json", 503, "application/json", `"error":"no quotes available"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewServer(Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv.AddQuotes(tt.texts)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			srv.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status %d; want %d", rec.Code, tt.status)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != tt.ctype {
+				t.Errorf("Content-Type %q; want %q", ct, tt.ctype)
+			}
+			if body := rec.Body.String(); !strings.Contains(body, tt.content) {
+				t.Errorf("body %q lacks %q", body, tt.content)
+			}
+			if strings.HasPrefix(tt.ctype, "application/json") && !json.Valid(rec.Body.Bytes()) {
+				t.Errorf("invalid JSON %q", rec.Body)
+			}
+		})
+	}
+}
+
+func TestServerFormats(t *testing.T) {
+	Formats["shout"] = Format{
+		ContentType: "text/x-shout",
+		Write: func(w io.Writer, q Quote) error {
+			_, err := io.WriteString(w, strings.ToUpper(q.Text))
+			return err
+		},
+	}
+	MediaTypes["text/x-shout"] = "shout"
+	defer func() {
+		delete(Formats, "shout")
+		delete(MediaTypes, "text/x-shout")
+	}()
+
+	srv, _ := NewServer(Config{})
+	srv.AddQuotes([]string{"a quote"})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/x-shout")
+	srv.ServeHTTP(rec, req)
+	if body := rec.Body.String(); body != "A QUOTE" {
+		t.Errorf("registered format served %q; want %q", body, "A QUOTE")
+	}
+}
@@ -0,0 +1,27 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"net/http"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// handleQR serves the selected quote encoded as a QR code
+func handleQR(w http.ResponseWriter, r *http.Request) {
+	_, selection := selectQuote()
+	if selection == nil {
+		w.WriteHeader(emptyStatus)
+		return
+	}
+
+	// encoding only fails when the quote exceeds QR capacity
+	png, err := qrcode.Encode(selection.Text, qrcode.Medium, -4)
+	if err != nil {
+		w.WriteHeader(413)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	qrreader "github.com/makiuchi-d/gozxing/qrcode"
+)
+
+func TestQR(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want int
+		text string
+	}{
+		{"quote", "a quote\n", 200, "a quote"},
+		{"multiline", "first\nsecond\n", 200, "first\nsecond"},
+		{"unicode", "Grüße, 世界\n", 200, "Grüße, 世界"},
+		{"too long", strings.Repeat("x", 3000) + "\n", 413, ""},
+		{"empty pool", "", 503, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadPool(t, tt.src)
+			rec := httptest.NewRecorder()
+			handleQR(rec, httptest.NewRequest("GET", "/quote.png", nil))
+			if rec.Code != tt.want {
+				t.Fatalf("got %d; want %d", rec.Code, tt.want)
+			}
+			if tt.want != 200 {
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+				t.Errorf("Content-Type %q; want image/png", ct)
+			}
+
+			img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := qrreader.NewQRCodeReader().Decode(bmp, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.GetText() != tt.text {
+				t.Errorf("QR code reads %q; want %q", res.GetText(), tt.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/jktr/httpqotdd/qotd"
+)
+
+var (
+	// set once the initial load is done, or at startup with -lazy
+	startedAt time.Time
+
+	// set as soon as shutdown begins, so that load balancers
+	// stop sending traffic while connections drain
+	shuttingDown int32
+)
+
+// handleHealth answers 503 while the pool is empty or the
+// server is shutting down. With ?deep=1 it also selects and
+// renders a quote, answering 503 should that fail or take
+// longer than -health-timeout, e.g. behind a stuck reload.
+// With -lazy, an empty pool is healthy until the first load.
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	pending := lazy && atomic.LoadInt32(&loaded) == 0
+	if r.URL.Query().Get("deep") == "" || pending {
+		if atomic.LoadInt32(&shuttingDown) == 1 || !pending && poolSize() == 0 {
+			w.WriteHeader(503)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- deepCheck() }()
+
+	w.Header().Set("Cache-Control", "no-store")
+	select {
+	case err := <-done:
+		if err != nil || atomic.LoadInt32(&shuttingDown) == 1 {
+			w.WriteHeader(503)
+		}
+	case <-ctx.Done():
+		w.WriteHeader(503)
+	}
+}
+
+// deepCheck goes through the motions of serving a quote
+func deepCheck() error {
+	_, q := selectQuote()
+	if q == nil {
+		return errors.New("no quotes available")
+	}
+	return qotd.Formats["txt"].Write(ioutil.Discard, *q)
+}
+
+// handlePing answers 200 without touching the pool, for
+// liveness probes that shouldn't cost a selection
+func handlePing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// handleReady answers 503 until the quotes are loaded (or will be
+// loaded on demand) and -ready-delay has passed since, and again
+// once shutdown begins
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if atomic.LoadInt32(&shuttingDown) == 1 ||
+		!lazy && atomic.LoadInt32(&loaded) == 0 || time.Since(startedAt) < readyDelay {
+		w.WriteHeader(503)
+	}
+}
@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReady(t *testing.T) {
+	savedStart, savedLoaded := startedAt, atomic.LoadInt32(&loaded)
+	t.Cleanup(func() {
+		startedAt = savedStart
+		atomic.StoreInt32(&loaded, savedLoaded)
+		atomic.StoreInt32(&shuttingDown, 0)
+	})
+	tests := []struct {
+		name     string
+		loaded   bool
+		lazy     string
+		delay    string
+		since    time.Duration // since startup
+		shutdown bool
+		want     int
+	}{
+		{"loaded", true, "false", "0s", 0, false, 200},
+		{"loading", false, "false", "0s", 0, false, 503},
+		{"lazy", false, "true", "0s", 0, false, 200},
+		{"delayed", true, "false", "1m", 30 * time.Second, false, 503},
+		{"delay passed", true, "false", "1m", 2 * time.Minute, false, 200},
+		{"lazy delayed", false, "true", "1m", 30 * time.Second, false, 503},
+		{"shutting down", true, "false", "0s", time.Hour, true, 503},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "lazy", tt.lazy)
+			setFlag(t, "ready-delay", tt.delay)
+			startedAt = time.Now().Add(-tt.since)
+			atomic.StoreInt32(&loaded, 0)
+			if tt.loaded {
+				atomic.StoreInt32(&loaded, 1)
+			}
+			atomic.StoreInt32(&shuttingDown, 0)
+			if tt.shutdown {
+				atomic.StoreInt32(&shuttingDown, 1)
+			}
+			rec := httptest.NewRecorder()
+			handleReady(rec, httptest.NewRequest("GET", "/readyz", nil))
+			if rec.Code != tt.want {
+				t.Errorf("got %d; want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadyDelay(t *testing.T) {
+	const delay = 500 * time.Millisecond
+	file := writeSources(t, "a quote\n")[0]
+	port := freePort(t)
+	started := time.Now()
+	startDaemon(t, "-port", port, "-ready-delay", delay.String(), file)
+	url := "http://127.0.0.1:" + port + "/readyz"
+	if code, _ := fetch(t, url); code != 503 {
+		t.Fatalf("got %d right after loading; want 503", code)
+	}
+	for {
+		code, _ := fetch(t, url)
+		if code == 200 {
+			break
+		}
+		if code != 503 || time.Since(started) > 10*time.Second {
+			t.Fatalf("got %d; want 503 until ready", code)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if elapsed := time.Since(started); elapsed < delay {
+		t.Errorf("ready after %v; want at least %v", elapsed, delay)
+	}
+	// quotes are served all along
+	if code, body := fetch(t, "http://127.0.0.1:"+port+"/quote"); code != 200 || body != "a quote\n" {
+		t.Errorf("got %d %q; want the quote", code, body)
+	}
+}
+
+func TestPing(t *testing.T) {
+	port := freePort(t)
+	startDaemon(t, "-port", port, writeSources(t, "one\n\ntwo\n\nthree\n")[0])
+	base := "http://127.0.0.1:" + port
+	fetch(t, base+"/quote")
+
+	// what serving a quote would change; reading the served
+	// counts is a request of its own, though
+	requests := func() int {
+		_, metrics := fetch(t, base+"/metrics")
+		for _, line := range strings.Split(metrics, "\n") {
+			if strings.HasPrefix(line, "httpqotdd_quote_requests_total ") {
+				n, _ := strconv.Atoi(strings.Fields(line)[1])
+				return n
+			}
+		}
+		t.Fatalf("no request count in %q", metrics)
+		return 0
+	}
+	before := requests()
+	_, served := fetch(t, base+"/stats/served")
+	for i := 0; i < 5; i++ {
+		if code, body := fetch(t, base+"/ping"); code != 200 || body != "" {
+			t.Fatalf("got %d %q; want 200 and no body", code, body)
+		}
+		resp, err := http.Head(base + "/ping")
+		if err != nil || resp.StatusCode != 200 {
+			t.Fatalf("HEAD: got %v, %v", resp, err)
+		}
+	}
+	if n := requests() - before; n != 1 {
+		t.Errorf("counted %d quote requests; want only the one for the served counts", n)
+	}
+	if _, after := fetch(t, base+"/stats/served"); after != served {
+		t.Errorf("served counts went from %s to %s", served, after)
+	}
+}
+
+func TestDeepHealth(t *testing.T) {
+	t.Cleanup(func() { atomic.StoreInt32(&shuttingDown, 0) })
+	tests := []struct {
+		name     string
+		src      string
+		query    string
+		stuck    bool // whether quotesM is held throughout
+		shutdown bool
+		want     int
+	}{
+		{"shallow", "a quote\n", "", false, false, 200},
+		{"deep", "a quote\n", "?deep=1", false, false, 200},
+		{"shallow empty", "", "", false, false, 503},
+		{"deep empty", "", "?deep=1", false, false, 503},
+		{"deep shutting down", "a quote\n", "?deep=1", false, true, 503},
+		{"shallow stuck", "a quote\n", "", true, false, 200},
+		{"deep stuck", "a quote\n", "?deep=1", true, false, 503},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// -cache has selections take quotesM
+			setFlag(t, "cache", "1h")
+			setFlag(t, "health-timeout", "50ms")
+			loadPool(t, tt.src)
+			atomic.StoreInt32(&shuttingDown, 0)
+			if tt.shutdown {
+				atomic.StoreInt32(&shuttingDown, 1)
+			}
+			if tt.stuck {
+				quotesM.Lock()
+			}
+			start := time.Now()
+			rec := httptest.NewRecorder()
+			handleHealth(rec, httptest.NewRequest("GET", "/health"+tt.query, nil))
+			took := time.Since(start)
+			if tt.stuck {
+				quotesM.Unlock()
+			}
+			if rec.Code != tt.want {
+				t.Errorf("got %d; want %d", rec.Code, tt.want)
+			}
+			if took > time.Second {
+				t.Errorf("took %v; want at most -health-timeout", took)
+			}
+			if tt.query != "" && rec.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("Cache-Control %q; want no-store", rec.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
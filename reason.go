@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// writeWithReason sends a 200 response with a custom reason phrase.
+// net/http always uses the standard phrase, so this takes over the
+// connection and writes the response itself; the connection is
+// closed afterwards.
+func writeWithReason(w http.ResponseWriter, r *http.Request, reason string, body []byte) error {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return errors.New("connection does not support custom status reasons")
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	h := w.Header()
+	h.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	h.Set("Connection", "close")
+
+	fmt.Fprintf(buf, "HTTP/1.1 200 %s\r\n", reason)
+	h.Write(buf)
+	buf.WriteString("\r\n")
+	if r.Method != http.MethodHead {
+		buf.Write(body)
+	}
+	return buf.Flush()
+}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatusReason(t *testing.T) {
+	loadPool(t, "a quote\n")
+	setFlag(t, "status-reason", "true")
+	srv := httptest.NewServer(http.HandlerFunc(handleQuote))
+	defer srv.Close()
+
+	tests := []struct {
+		method string
+		body   string
+	}{
+		{"GET", "a quote\n"},
+		{"HEAD", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.Write([]byte(tt.method + " /quote HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+			r := bufio.NewReader(conn)
+			if line, err := r.ReadString('\n'); err != nil || line != "HTTP/1.1 200 Quote-0\r\n" {
+				t.Fatalf("status line %q, %v; want the quote index as reason", line, err)
+			}
+
+			// the rest is a regular response
+			conn.Close()
+			req, _ := http.NewRequest(tt.method, srv.URL+"/quote", nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != 200 || resp.Status != "200 Quote-0" || string(body) != tt.body {
+				t.Errorf("got %q %q; want 200 Quote-0 %q", resp.Status, body, tt.body)
+			}
+			if resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+				t.Errorf("Content-Type %q", resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"math/rand"
+	"sync"
+)
+
+var (
+	// ring of the last -recent-window indices served from the pool
+	recent     []int
+	recentNext int
+	recentM    sync.Mutex
+)
+
+// markServed records idx as served, pushing the oldest
+// index out of the window once it's full
+func markServed(idx int) {
+	if recentWindow <= 0 || idx < 0 {
+		return
+	}
+	recentM.Lock()
+	defer recentM.Unlock()
+	if len(recent) < recentWindow {
+		recent = append(recent, idx)
+		return
+	}
+	recent[recentNext] = idx
+	recentNext = (recentNext + 1) % recentWindow
+}
+
+// resetRecent forgets the window, as its indices
+// are meaningless for a new pool
+func resetRecent() {
+	recentM.Lock()
+	recent, recentNext = nil, 0
+	recentM.Unlock()
+}
+
+// avoidRecent replaces a pick from an n quote pool with one outside
+// the window, unless the window covers the whole pool
+func avoidRecent(idx, n int, pick func() int) int {
+	if recentWindow <= 0 || recentWindow >= n {
+		return idx
+	}
+	recentM.Lock()
+	defer recentM.Unlock()
+
+	served := make(map[int]bool, len(recent))
+	for _, i := range recent {
+		served[i] = true
+	}
+	// retrying keeps -bias weights intact; fall back to a
+	// uniform pick should the window hold most of the pool
+	for tries := 0; served[idx] && tries < 16; tries++ {
+		idx = pick()
+	}
+	if served[idx] {
+		rest := make([]int, 0, n-len(served))
+		for i := 0; i < n; i++ {
+			if !served[i] {
+				rest = append(rest, i)
+			}
+		}
+		idx = rest[rand.Intn(len(rest))]
+	}
+	return idx
+}
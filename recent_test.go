@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestRecentWindow(t *testing.T) {
+	tests := []struct {
+		window  int
+		bias    string
+		repeats bool // whether the window is too large to hold
+	}{
+		{1, "none", false},
+		{3, "none", false},
+		{4, "none", false},
+		{3, "long", false},
+		{5, "none", true},
+		{10, "none", true},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.window)+" "+tt.bias, func(t *testing.T) {
+			setFlag(t, "recent-window", strconv.Itoa(tt.window))
+			setFlag(t, "bias", tt.bias)
+			t.Cleanup(resetRecent)
+			loadPool(t, "zero\n\none\n\ntwo\n\nthree\n\nfour, the longest quote\n")
+
+			served := []string{}
+			repeated := false
+			for i := 0; i < 200; i++ {
+				rec := httptest.NewRecorder()
+				handleQuote(rec, httptest.NewRequest("GET", "/quote", nil))
+				q := rec.Body.String()
+				for j := len(served) - 1; j >= 0 && j >= len(served)-tt.window; j-- {
+					if served[j] == q {
+						repeated = true
+						if !tt.repeats {
+							t.Fatalf("served %q again within %d of %q", q, tt.window, served)
+						}
+					}
+				}
+				served = append(served, q)
+			}
+			if tt.repeats && !repeated {
+				t.Errorf("never repeated a quote within %d of 5; want the window ignored", tt.window)
+			}
+		})
+	}
+}
+
+func TestRecentWindowIgnoresPeeks(t *testing.T) {
+	setFlag(t, "recent-window", "1")
+	t.Cleanup(resetRecent)
+	loadPool(t, "zero\n\none\n")
+
+	// HEAD requests don't count as served, so GETs still alternate
+	var last string
+	for i := 0; i < 50; i++ {
+		handleQuote(httptest.NewRecorder(), httptest.NewRequest("HEAD", "/quote", nil))
+		rec := httptest.NewRecorder()
+		handleQuote(rec, httptest.NewRequest("GET", "/quote", nil))
+		if rec.Body.String() == last {
+			t.Fatalf("served %q twice in a row", last)
+		}
+		last = rec.Body.String()
+	}
+}
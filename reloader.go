@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// All reloads after the initial load go through a single goroutine,
+// so that triggers firing together (timers, signals, requests)
+// coalesce into one fetch instead of racing each other.
+var (
+	reloadPending = make(chan struct{}, 1)
+	reloadWaiters []chan error
+	reloadM       sync.Mutex
+)
+
+// requestReload asks for a reload and returns a channel receiving
+// its result. Requests made before a pending reload has started
+// share that reload.
+func requestReload() <-chan error {
+	done := make(chan error, 1)
+	reloadM.Lock()
+	reloadWaiters = append(reloadWaiters, done)
+	reloadM.Unlock()
+
+	select {
+	case reloadPending <- struct{}{}:
+	default:
+	}
+	return done
+}
+
+// runReloads serves reload requests until the process exits. Requests
+// arriving within -reload-min-interval of the last reload are deferred
+// until it has passed, coalescing with any others made meanwhile.
+// Cancelling ctx aborts the reload in progress.
+func runReloads(ctx context.Context, sources []string) {
+	var last time.Time
+	for range reloadPending {
+		if wait := reloadMinInterval - time.Since(last); wait > 0 {
+			time.Sleep(wait)
+		}
+		last = time.Now()
+
+		reloadM.Lock()
+		waiters := reloadWaiters
+		reloadWaiters = nil
+		reloadM.Unlock()
+
+		err := reloadQuotes(ctx, sources)
+		if err != nil && ctx.Err() == nil {
+			atomic.AddUint64(&reloadFailures, 1)
+			log.Println(err)
+		}
+		for _, done := range waiters {
+			done <- err
+		}
+	}
+}
+
+var (
+	// successful loads, including the initial one
+	reloads int32
+
+	// closed once -max-reloads reloads have succeeded
+	retired = make(chan struct{})
+)
+
+func countReload() {
+	if n := atomic.AddInt32(&reloads, 1); maxReloads > 0 && n == int32(maxReloads)+1 {
+		close(retired)
+	}
+}
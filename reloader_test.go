@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReloadsCoalesce(t *testing.T) {
+	file := writeSources(t, "a quote\n")[0]
+	d := startDaemon(t, "-port", freePort(t), "-verbose", "-reload-min-interval", "300ms", file)
+	reloads := func() int { return strings.Count(d.log.String(), "quotes reloaded") }
+	d.awaitLog(t, "quotes reloaded")
+	initial := reloads()
+
+	const signals = 10
+	for i := 0; i < signals; i++ {
+		d.cmd.Process.Signal(syscall.SIGHUP)
+		time.Sleep(5 * time.Millisecond)
+	}
+	// the first reload runs right away, the others wait for it
+	// and -reload-min-interval, sharing the next one
+	time.Sleep(time.Second)
+	if n := reloads() - initial; n < 1 || n > 3 {
+		t.Errorf("%d SIGHUPs caused %d reloads; want them coalesced into 1 to 3", signals, n)
+	}
+}
+
+func TestMaxReloads(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		hup  bool
+	}{
+		{"timer", []string{"-reload", "50ms"}, false},
+		{"SIGHUP", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeSources(t, "a quote\n")[0]
+			args := append([]string{"-port", freePort(t), "-verbose", "-max-reloads", "2"}, tt.args...)
+			d := startDaemon(t, append(args, file)...)
+			if tt.hup {
+				for i := 1; i <= 2; i++ {
+					select {
+					case <-d.exited:
+						t.Fatalf("exited after %d reloads", i-1)
+					case <-time.After(200 * time.Millisecond):
+					}
+					d.cmd.Process.Signal(syscall.SIGHUP)
+				}
+			}
+			if err := d.wait(t); err != nil {
+				t.Fatalf("exited with %v; want a clean exit", err)
+			}
+			log := d.log.String()
+			// the initial load doesn't count towards the reloads
+			if n := strings.Count(log, "quotes reloaded"); n != 3 {
+				t.Errorf("loaded %d times; want 3", n)
+			}
+			if !strings.Contains(log, "reached -max-reloads") {
+				t.Errorf("logged %q", log)
+			}
+		})
+	}
+}
+
+func TestReloadMinInterval(t *testing.T) {
+	const interval = 250 * time.Millisecond
+	var fetchesM sync.Mutex
+	var fetches []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetchesM.Lock()
+		fetches = append(fetches, time.Now())
+		fetchesM.Unlock()
+		w.Write([]byte("a quote\n"))
+	}))
+	defer srv.Close()
+
+	d := startDaemon(t, "-port", freePort(t), "-reload-min-interval", interval.String(), srv.URL)
+	storm := time.Now()
+	for time.Since(storm) < time.Second {
+		d.cmd.Process.Signal(syscall.SIGHUP)
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(2 * interval)
+
+	fetchesM.Lock()
+	defer fetchesM.Unlock()
+	// the initial load, then one reload right away and one per
+	// interval at most, including one for the last SIGHUPs
+	if n := len(fetches); n < 3 || n > 3+int(time.Second/interval) {
+		t.Errorf("fetched %d times in a second of SIGHUPs", n)
+	}
+	for i := 2; i < len(fetches); i++ {
+		if gap := fetches[i].Sub(fetches[i-1]); gap < interval-10*time.Millisecond {
+			t.Errorf("reloads %d and %d only %v apart", i-1, i, gap)
+		}
+	}
+}
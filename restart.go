@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// set by a -hup-restart parent in place of LISTEN_PID, as it can't
+	// know the child's pid up front; it names the parent's pid
+	restartParentEnv = "HTTPQOTDD_RESTART_PARENT"
+
+	// set by a -hup-restart parent to the fd of a pipe the child
+	// writes to once it's ready to take over
+	restartReadyEnv = "HTTPQOTDD_RESTART_READY"
+
+	// how long a -hup-restart parent waits for its child to
+	// become ready before giving up on it
+	restartTimeout = time.Minute
+)
+
+// readiness pipe passed by a -hup-restart parent, if any
+var restartReady *os.File
+
+func init() {
+	fd, err := strconv.Atoi(os.Getenv(restartReadyEnv))
+	if err != nil {
+		return
+	}
+	// don't pass the pipe on to child processes like git either,
+	// or they'd keep it open should we die
+	syscall.CloseOnExec(fd)
+	restartReady = os.NewFile(uintptr(fd), "restart-ready")
+	os.Unsetenv(restartReadyEnv)
+}
+
+// notifyParent tells a -hup-restart parent that we're
+// ready, so that it can hand over and shut down
+func notifyParent() {
+	if restartReady == nil {
+		return
+	}
+	restartReady.Write([]byte("READY=1"))
+	restartReady.Close()
+	restartReady = nil
+}
+
+// restartSelf starts a new instance of the server with the same
+// arguments, handing it the listeners by the socket activation
+// protocol, and waits for it to be ready; it returns the child's
+// pid. Should the child exit first, or take longer than
+// restartTimeout, the listeners are left to the caller.
+func restartSelf(listeners, gophers []net.Listener) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	files := []*os.File{}
+	names := []string{}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	add := func(ls []net.Listener, name string) error {
+		for _, l := range ls {
+			tl, ok := l.(*net.TCPListener)
+			if !ok {
+				return fmt.Errorf("can't hand over %s listener %v", name, l.Addr())
+			}
+			f, err := tl.File()
+			if err != nil {
+				return err
+			}
+			files = append(files, f)
+			names = append(names, name)
+		}
+		return nil
+	}
+	if err := add(listeners, "http"); err != nil {
+		return 0, err
+	}
+	if err := add(gophers, "gopher"); err != nil {
+		return 0, err
+	}
+
+	ready, w, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer ready.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"LISTEN_FDS="+strconv.Itoa(len(files)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+		restartParentEnv+"="+strconv.Itoa(os.Getpid()),
+		restartReadyEnv+"="+strconv.Itoa(listenFdsStart+len(files)))
+	cmd.ExtraFiles = append(files, w)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Start()
+	// only the child may hold the write end, so that
+	// reads see EOF once it's gone
+	w.Close()
+	// passing the sockets put them in blocking mode, see os.File.Fd;
+	// as they share that with ours, our accepts would hang
+	for _, f := range files {
+		if rc, err := f.SyscallConn(); err == nil {
+			rc.Control(func(fd uintptr) { syscall.SetNonblock(int(fd), true) })
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	go cmd.Wait()
+
+	// a child that dies, e.g. on a source that no longer loads,
+	// closes the pipe without writing to it
+	notified := make(chan bool, 1)
+	go func() {
+		n, _ := ready.Read(make([]byte, 16))
+		notified <- n > 0
+	}()
+	select {
+	case ok := <-notified:
+		if !ok {
+			return 0, errors.New("new instance exited before it was ready")
+		}
+	case <-time.After(restartTimeout):
+		cmd.Process.Kill()
+		return 0, fmt.Errorf("new instance not ready after %v", restartTimeout)
+	}
+
+	// the child takes over as the service's main process
+	sdNotify("MAINPID=" + strconv.Itoa(cmd.Process.Pid))
+	return cmd.Process.Pid, nil
+}
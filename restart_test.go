@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestRestartSelf(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "quotes.txt")
+	ioutil.WriteFile(file, []byte("served by the new instance\n"), 0644)
+
+	tests := []struct {
+		name   string
+		source string
+		ready  bool
+	}{
+		{"ready", file, true},
+		{"source gone", file + ".missing", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("served by the old instance\n"))
+			})}
+			go srv.Serve(l)
+			defer srv.Close()
+
+			args := os.Args
+			os.Args = []string{args[0], tt.source}
+			pid, err := restartSelf([]net.Listener{l}, nil)
+			os.Args = args
+			if !tt.ready {
+				if err == nil {
+					syscall.Kill(pid, syscall.SIGTERM)
+					t.Fatal("restarted with a broken source")
+				}
+				if got := get(t, l.Addr()); !strings.Contains(got, "old instance") {
+					t.Errorf("after the failed restart got %q; want the old instance", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer syscall.Kill(pid, syscall.SIGTERM)
+
+			// once the old instance lets go, the new one has the socket
+			srv.Close()
+			if got := get(t, l.Addr()); !strings.Contains(got, "new instance") {
+				t.Errorf("after the restart got %q; want the new instance", got)
+			}
+		})
+	}
+}
+
+func get(t *testing.T, addr net.Addr) string {
+	t.Helper()
+	resp, err := http.Get("http://" + addr.String() + "/quote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return string(body)
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+var (
+	// times each quote was served, by content hash, so that
+	// quotes a reload leaves unchanged keep their counts
+	serveCounts  = map[string]uint64{}
+	serveCountsM sync.Mutex
+)
+
+func countServed(q *Quote) {
+	serveCountsM.Lock()
+	serveCounts[q.Hash]++
+	serveCountsM.Unlock()
+}
+
+// mergeServeCounts carries the counts of quotes still in the new
+// pool qs over and drops those of quotes it no longer has
+func mergeServeCounts(qs []Quote) {
+	hashes := make(map[string]bool, len(qs))
+	for _, q := range qs {
+		hashes[q.Hash] = true
+	}
+
+	serveCountsM.Lock()
+	defer serveCountsM.Unlock()
+	dropped := 0
+	for hash := range serveCounts {
+		if !hashes[hash] {
+			delete(serveCounts, hash)
+			dropped++
+		}
+	}
+	if verbose && dropped > 0 {
+		log.Printf("dropped serve counts of %d quotes no longer in the pool\n", dropped)
+	}
+}
+
+// handleServed lists how often each quote was served since it
+// entered the pool, most served first
+func handleServed(w http.ResponseWriter, r *http.Request) {
+	type served struct {
+		Hash   string `json:"hash"`
+		Served uint64 `json:"served"`
+	}
+	list := []served{}
+	serveCountsM.Lock()
+	for hash, n := range serveCounts {
+		list = append(list, served{hash, n})
+	}
+	serveCountsM.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Served != list[j].Served {
+			return list[i].Served > list[j].Served
+		}
+		return list[i].Hash < list[j].Hash
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
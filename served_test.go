@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestServeCounts(t *testing.T) {
+	serveCountsM.Lock()
+	saved := serveCounts
+	serveCounts = map[string]uint64{}
+	serveCountsM.Unlock()
+	t.Cleanup(func() {
+		serveCountsM.Lock()
+		serveCounts = saved
+		serveCountsM.Unlock()
+	})
+
+	file := writeSources(t, "")[0]
+	loadPool(t, "")
+	hashes := map[string]string{} // by quote text
+	steps := []struct {
+		name  string
+		src   string
+		serve map[string]int
+		want  string // served counts by quote text, most served first
+	}{
+		{"initial", "a\n\nb\n\nc\n", map[string]int{"a": 3, "b": 1}, "a:3 b:1"},
+		{"reordered", "c\n\nb\n\na\n", map[string]int{"b": 1}, "a:3 b:2"},
+		{"removed and added", "b\n\nd\n", map[string]int{"d": 1}, "b:2 d:1"},
+		{"changed", "b2\n\nd\n", nil, "d:1"},
+		{"unchanged", "b2\n\nd\n", map[string]int{"b2": 1, "d": 1}, "d:2 b2:1"},
+	}
+	for _, s := range steps {
+		if err := ioutil.WriteFile(file, []byte(s.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := reloadQuotes(context.Background(), []string{file}); err != nil {
+			t.Fatal(err)
+		}
+		for i, q := range pool.Quotes() {
+			hashes[q.Hash] = q.Text
+			setFlag(t, "pin", strconv.Itoa(i))
+			for n := 0; n < s.serve[q.Text]; n++ {
+				handleQuote(httptest.NewRecorder(), httptest.NewRequest("GET", "/quote", nil))
+			}
+		}
+		setFlag(t, "pin", "-1")
+
+		rec := httptest.NewRecorder()
+		handleServed(rec, httptest.NewRequest("GET", "/stats/served", nil))
+		var list []struct {
+			Hash   string
+			Served uint64
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("%s: %v in %q", s.name, err, rec.Body)
+		}
+		got := []string{}
+		for _, e := range list {
+			got = append(got, hashes[e.Hash]+":"+strconv.FormatUint(e.Served, 10))
+		}
+		if strings.Join(got, " ") != s.want {
+			t.Errorf("%s: served %q; want %s", s.name, got, s.want)
+		}
+	}
+}
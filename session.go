@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/hex"
+	mrand "math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jktr/httpqotdd/qotd"
+)
+
+const sessionCookie = "qotd-session"
+
+// session holds the quotes a client has yet to be served
+type session struct {
+	id       string
+	pool     *qotd.Snapshot // pool the order was drawn from
+	order    []int
+	lastSeen time.Time
+}
+
+var (
+	// sessions by id, and in the order they were last seen,
+	// most recent first
+	sessions   = map[string]*list.Element{}
+	sessionLRU = list.New()
+	sessionsM  sync.Mutex
+)
+
+// sessionQuote selects a quote the client's session hasn't seen yet,
+// starting over once all have been served or the pool was replaced
+func sessionQuote(w http.ResponseWriter, r *http.Request) (int, *Quote) {
+	if _, ok := calendar.day(time.Now()); ok || pin >= 0 || cache > 0 {
+		return selectQuote()
+	}
+
+	sessionsM.Lock()
+	defer sessionsM.Unlock()
+
+	s := lookupSession(w, r)
+
+	snap := pool.Snapshot()
+	if len(snap.Quotes) == 0 {
+		return -1, nil
+	}
+	if s.pool != snap || len(s.order) == 0 {
+		s.pool = snap
+		s.order = mrand.Perm(len(snap.Quotes))
+	}
+	idx := s.order[0]
+	s.order = s.order[1:]
+	return idx, &snap.Quotes[idx]
+}
+
+// lookupSession returns the client's session, starting a new one
+// if the request carries no live session cookie; sessionsM must be held
+func lookupSession(w http.ResponseWriter, r *http.Request) *session {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if e, ok := sessions[c.Value]; ok && time.Since(e.Value.(*session).lastSeen) < sessionIdle {
+			sessionLRU.MoveToFront(e)
+			s := e.Value.(*session)
+			s.lastSeen = time.Now()
+			return s
+		}
+	}
+
+	expireSessions()
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		// serve without a session rather than fail the request
+		return &session{}
+	}
+	s := &session{id: hex.EncodeToString(id), lastSeen: time.Now()}
+	sessions[s.id] = sessionLRU.PushFront(s)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    s.id,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return s
+}
+
+// expireSessions drops idle sessions and, if still at -session-max,
+// the least recently used ones to make room; as sessions are kept
+// in the order they were last seen, it only looks at those it drops
+// and the one after. sessionsM must be held.
+func expireSessions() {
+	for e := sessionLRU.Back(); e != nil; e = sessionLRU.Back() {
+		s := e.Value.(*session)
+		if len(sessions) < sessionMax && time.Since(s.lastSeen) < sessionIdle {
+			return
+		}
+		sessionLRU.Remove(e)
+		delete(sessions, s.id)
+	}
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"container/list"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// resetSessions starts the test without sessions, and leaves
+// none behind
+func resetSessions(t *testing.T) {
+	reset := func() {
+		sessionsM.Lock()
+		sessions, sessionLRU = map[string]*list.Element{}, list.New()
+		sessionsM.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestSessions(t *testing.T) {
+	setFlag(t, "sessions", "true")
+	resetSessions(t)
+	loadPool(t, "one\n\ntwo\n\nthree\n\nfour\n\nfive\n")
+	srv := httptest.NewServer(http.HandlerFunc(handleQuote))
+	defer srv.Close()
+
+	newClient := func() *http.Client {
+		jar, _ := cookiejar.New(nil)
+		return &http.Client{Jar: jar}
+	}
+	get := func(c *http.Client) string {
+		t.Helper()
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	alice, bob := newClient(), newClient()
+	for round := 0; round < 3; round++ {
+		seen := map[string]bool{}
+		for i := 0; i < 5; i++ {
+			q := get(alice)
+			if seen[q] {
+				t.Fatalf("round %d: %q repeated before all were served", round, q)
+			}
+			seen[q] = true
+			// another session doesn't use up alice's quotes
+			get(bob)
+		}
+	}
+	if len(sessions) != 2 {
+		t.Errorf("tracking %d sessions; want 2", len(sessions))
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	setFlag(t, "sessions", "true")
+	setFlag(t, "session-max", "2")
+	setFlag(t, "session-idle", "100ms")
+	resetSessions(t)
+	loadPool(t, "one\n\ntwo\n")
+
+	// get serves a quote within the session of cookie,
+	// returning the cookie of a new session if one was started
+	get := func(cookie *http.Cookie) *http.Cookie {
+		req := httptest.NewRequest("GET", "/quote", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		handleQuote(rec, req)
+		if cs := rec.Result().Cookies(); len(cs) > 0 {
+			return cs[0]
+		}
+		return nil
+	}
+
+	a := get(nil)
+	if a == nil {
+		t.Fatal("no session cookie set")
+	}
+	if get(a) != nil {
+		t.Error("live session replaced")
+	}
+	b := get(nil)
+	get(a) // a is now the most recently used
+	get(nil)
+	if len(sessions) != 2 {
+		t.Errorf("tracking %d sessions; want at most 2", len(sessions))
+	}
+	if get(a) != nil {
+		t.Error("recently used session dropped")
+	}
+	if get(b) == nil {
+		t.Error("least recently used session kept past -session-max")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if get(a) == nil {
+		t.Error("idle session kept past -session-idle")
+	}
+	if len(sessions) != 1 {
+		t.Errorf("tracking %d sessions after they went idle; want 1", len(sessions))
+	}
+}
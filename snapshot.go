@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeQuotes writes qs in the plain source format, escaping
+// lines that would otherwise be read back as comments or breaks
+func writeQuotes(w io.Writer, qs []Quote) error {
+	bw := bufio.NewWriter(w)
+	for i, q := range qs {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		if q.Author != "" {
+			bw.WriteString("@author: " + q.Author + "\n")
+		}
+		if q.Type != "" {
+			bw.WriteString("@type: " + q.Type + "\n")
+		}
+		if q.Category != "" {
+			bw.WriteString("@category: " + q.Category + "\n")
+		}
+		if q.Image != "" {
+			bw.WriteString("@image: " + q.Image + "\n")
+		}
+		for _, line := range strings.Split(q.Text, "\n") {
+			switch {
+			case line == "":
+				line = "\\"
+			case strings.HasPrefix(line, "#"):
+				line = "\\" + line
+			}
+			bw.WriteString(line + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+func handleAll(w http.ResponseWriter, r *http.Request) {
+	// writing to a slow client must not hold up reloads
+	qs := pool.Quotes()
+	if len(qs) == 0 {
+		w.WriteHeader(emptyStatus)
+		return
+	}
+	if sanitizeOutput {
+		// a copy, as the pool's quotes are shared
+		qs = append([]Quote(nil), qs...)
+		for i := range qs {
+			qs[i] = sanitizeQuote(qs[i])
+		}
+	}
+
+	w.Header().Set("Accept-Ranges", "quotes")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if spec := r.Header.Get("Range"); spec != "" {
+		first, last, ok := parseQuoteRange(spec, len(qs))
+		switch {
+		case !ok:
+			// as with bytes, a malformed range gets the whole pool
+		case first >= len(qs):
+			w.Header().Set("Content-Range", fmt.Sprintf("quotes */%d", len(qs)))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		default:
+			w.Header().Set("Content-Range", fmt.Sprintf("quotes %d-%d/%d", first, last, len(qs)))
+			w.WriteHeader(http.StatusPartialContent)
+			qs = qs[first : last+1]
+		}
+	}
+	writeQuotes(w, qs)
+}
+
+// parseQuoteRange parses a "quotes=first-last" Range header into
+// pool indices, clamping last to the pool; "first-" runs to the
+// end of the pool and "-n" selects its last n quotes
+func parseQuoteRange(spec string, n int) (first, last int, ok bool) {
+	if !strings.HasPrefix(spec, "quotes=") {
+		return 0, 0, false
+	}
+	spec = strings.TrimPrefix(spec, "quotes=")
+	i := strings.IndexByte(spec, '-')
+	if i < 0 {
+		return 0, 0, false
+	}
+	from, to := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+	var err error
+	switch {
+	case from == "":
+		var count int
+		if count, err = strconv.Atoi(to); err != nil || count <= 0 {
+			return 0, 0, false
+		}
+		if count > n {
+			count = n
+		}
+		first, last = n-count, n-1
+	case to == "":
+		if first, err = strconv.Atoi(from); err != nil || first < 0 {
+			return 0, 0, false
+		}
+		last = n - 1
+	default:
+		if first, err = strconv.Atoi(from); err != nil || first < 0 {
+			return 0, 0, false
+		}
+		if last, err = strconv.Atoi(to); err != nil || last < first {
+			return 0, 0, false
+		}
+		if last >= n {
+			last = n - 1
+		}
+	}
+	return first, last, true
+}
+
+// snapshotQuotes dumps the current pool to a timestamped
+// file in snapshotDir and returns its path
+func snapshotQuotes() (string, error) {
+	path := filepath.Join(snapshotDir,
+		"quotes-"+time.Now().Format("20060102T150405.000")+".txt")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+
+	err = writeQuotes(f, pool.Quotes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return path, err
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWriteQuotes(t *testing.T) {
+	tests := []struct {
+		name string
+		qs   []Quote
+	}{
+		{"plain", []Quote{{Text: "one"}, {Text: "two"}}},
+		{"metadata", []Quote{{Text: "one", Author: "Someone", Type: "markdown", Category: "misc"}}},
+		{"multiline", []Quote{{Text: "first\nsecond"}}},
+		{"blank lines", []Quote{{Text: "first\n\nthird"}}},
+		{"comment lines", []Quote{{Text: "# not a comment\n#nor this"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := writeQuotes(&b, tt.qs); err != nil {
+				t.Fatal(err)
+			}
+			qs, err := parseQuotes(context.Background(), strings.NewReader(b.String()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range qs {
+				qs[i].Hash = ""
+			}
+			if !reflect.DeepEqual(qs, tt.qs) {
+				t.Errorf("wrote\n%s\nwhich reads back as %+v; want %+v", b.String(), qs, tt.qs)
+			}
+		})
+	}
+}
+
+func TestSnapshotSignal(t *testing.T) {
+	src := "@author: Someone\none\n\ntwo\nover two lines\n"
+	dir := t.TempDir()
+	d := startDaemon(t, "-port", freePort(t), "-snapshot-dir", dir, writeSources(t, src)[0])
+	d.cmd.Process.Signal(syscall.SIGUSR1)
+
+	var snapshots []string
+	for deadline := time.Now().Add(5 * time.Second); len(snapshots) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("no snapshot written on SIGUSR1")
+		}
+		time.Sleep(10 * time.Millisecond)
+		snapshots, _ = filepath.Glob(filepath.Join(dir, "quotes-*.txt"))
+	}
+	// written by the time it's logged
+	for deadline := time.Now().Add(5 * time.Second); !strings.Contains(d.log.String(), "wrote snapshot"); {
+		if time.Now().After(deadline) {
+			t.Fatal("snapshot not logged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	got, err := ioutil.ReadFile(snapshots[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != src {
+		t.Errorf("snapshot is\n%s\nwant\n%s", got, src)
+	}
+}
+
+func TestAllRange(t *testing.T) {
+	var src []string
+	for i := 0; i < 10; i++ {
+		src = append(src, "q"+strconv.Itoa(i))
+	}
+	loadPool(t, strings.Join(src, "\n\n")+"\n")
+	tests := []struct {
+		rng          string
+		code         int
+		contentRange string
+		want         string // first and last quote served
+	}{
+		{"", 200, "", "q0-q9"},
+		{"quotes=2-4", 206, "quotes 2-4/10", "q2-q4"},
+		{"quotes=5-5", 206, "quotes 5-5/10", "q5-q5"},
+		{"quotes=8-19", 206, "quotes 8-9/10", "q8-q9"},
+		{"quotes=7-", 206, "quotes 7-9/10", "q7-q9"},
+		{"quotes=-3", 206, "quotes 7-9/10", "q7-q9"},
+		{"quotes=-30", 206, "quotes 0-9/10", "q0-q9"},
+		{"quotes=10-19", 416, "quotes */10", ""},
+		{"quotes=4-2", 200, "", "q0-q9"},
+		{"bytes=0-10", 200, "", "q0-q9"},
+		{"quotes=two-four", 200, "", "q0-q9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rng, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/all", nil)
+			if tt.rng != "" {
+				req.Header.Set("Range", tt.rng)
+			}
+			rec := httptest.NewRecorder()
+			handleAll(rec, req)
+			if rec.Code != tt.code || rec.Header().Get("Content-Range") != tt.contentRange {
+				t.Fatalf("got %d with Content-Range %q; want %d %q", rec.Code, rec.Header().Get("Content-Range"), tt.code, tt.contentRange)
+			}
+			if rec.Header().Get("Accept-Ranges") != "quotes" {
+				t.Errorf("Accept-Ranges %q", rec.Header().Get("Accept-Ranges"))
+			}
+			got := ""
+			if qs := strings.Fields(rec.Body.String()); len(qs) > 0 {
+				got = qs[0] + "-" + qs[len(qs)-1]
+			}
+			if got != tt.want {
+				t.Errorf("served %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sourceHealth tracks how the loads of a source have gone
+type sourceHealth struct {
+	failures    int // consecutive
+	lastError   string
+	lastSuccess time.Time
+}
+
+var (
+	sourceHealths  = map[string]*sourceHealth{}
+	sourceHealthsM sync.Mutex
+)
+
+// recordLoad notes the outcome of loading source, reporting
+// whether it went from healthy to failing or back
+func recordLoad(source string, err error) bool {
+	sourceHealthsM.Lock()
+	defer sourceHealthsM.Unlock()
+
+	h, ok := sourceHealths[source]
+	if !ok {
+		h = &sourceHealth{}
+		sourceHealths[source] = h
+	}
+	wasHealthy := h.failures == 0
+	if err != nil && err != errUnchanged {
+		h.failures++
+		h.lastError = err.Error()
+	} else {
+		h.failures = 0
+		h.lastSuccess = time.Now()
+	}
+	return wasHealthy != (h.failures == 0)
+}
+
+type sourceStatus struct {
+	Source      string     `json:"source"`
+	Healthy     bool       `json:"healthy"`
+	Failures    int        `json:"failures"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+// sourceStatuses reports the health of every source loaded so far
+func sourceStatuses() []sourceStatus {
+	sourceHealthsM.Lock()
+	statuses := []sourceStatus{}
+	for source, h := range sourceHealths {
+		s := sourceStatus{Source: redactSource(source), Healthy: h.failures == 0, Failures: h.failures}
+		if !s.Healthy {
+			s.LastError = strings.ReplaceAll(h.lastError, source, s.Source)
+		}
+		if !h.lastSuccess.IsZero() {
+			lastSuccess := h.lastSuccess
+			s.LastSuccess = &lastSuccess
+		}
+		statuses = append(statuses, s)
+	}
+	sourceHealthsM.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Source < statuses[j].Source
+	})
+	return statuses
+}
+
+// redactSource hides the password of a source URL, so that it
+// doesn't leak to clients
+func redactSource(source string) string {
+	if u, err := url.Parse(source); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return source
+}
@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDropFailedSources(t *testing.T) {
+	// whether each source is failing
+	failing := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing[r.URL.Path] {
+			http.Error(w, "broken", 500)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		w.Write([]byte(name + " one\n\n" + name + " two\n"))
+	}))
+	defer srv.Close()
+	sources := []string{srv.URL + "/a", srv.URL + "/b"}
+
+	status := func() map[string]sourceStatus {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handleStatus(rec, httptest.NewRequest("GET", "/status", nil))
+		var got struct{ Sources []sourceStatus }
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%v in %q", err, rec.Body)
+		}
+		byName := map[string]sourceStatus{}
+		for _, s := range got.Sources {
+			byName[strings.TrimPrefix(s.Source, srv.URL)] = s
+		}
+		return byName
+	}
+
+	for _, drop := range []string{"false", "true"} {
+		t.Run(drop, func(t *testing.T) {
+			setFlag(t, "drop-failed-sources", drop)
+			t.Cleanup(func() { sourceHealths = map[string]*sourceHealth{} })
+			loadPool(t, "")
+			steps := []struct {
+				failing []string
+				ok      bool
+				want    string // the pool, if the reload succeeded
+			}{
+				{nil, true, "a one|a two|b one|b two"},
+				{[]string{"/b"}, drop == "true", "a one|a two"},
+				{[]string{"/b"}, drop == "true", "a one|a two"},
+				{nil, true, "a one|a two|b one|b two"},
+				{[]string{"/a", "/b"}, false, ""},
+			}
+			for i, s := range steps {
+				failing = map[string]bool{}
+				for _, f := range s.failing {
+					failing[f] = true
+				}
+				before := strings.Join(poolTexts(), "|")
+				err := reloadQuotes(context.Background(), sources)
+				if (err == nil) != s.ok {
+					t.Fatalf("step %d: reload returned %v", i, err)
+				}
+				want := s.want
+				if !s.ok {
+					want = before
+				}
+				if got := strings.Join(poolTexts(), "|"); got != want {
+					t.Errorf("step %d: pool is %q; want %q", i, got, want)
+				}
+				// serving goes on from the healthy sources
+				for j := 0; j < 20 && want != ""; j++ {
+					rec := httptest.NewRecorder()
+					handleQuote(rec, httptest.NewRequest("GET", "/quote", nil))
+					if q := strings.TrimSuffix(rec.Body.String(), "\n"); !strings.Contains("|"+want+"|", "|"+q+"|") {
+						t.Errorf("step %d: served %q", i, q)
+					}
+				}
+
+				st := status()
+				for _, name := range []string{"/a", "/b"} {
+					if st[name].Healthy == failing[name] || st[name].Healthy != (st[name].LastError == "") {
+						t.Errorf("step %d: %s reported as %+v", i, name, st[name])
+					}
+				}
+			}
+			if f := status()["/b"].Failures; f != 1 {
+				t.Errorf("/b failed %d times in a row; want 1", f)
+			}
+		})
+	}
+}
+
+func TestFetchConcurrency(t *testing.T) {
+	const n = 4
+	tests := []struct {
+		concurrency int
+		failing     int // index of a failing source, or -1
+		drop        bool
+		want        string // the pool, or "" for a failed reload
+	}{
+		{1, -1, false, "0|1|2|3"},
+		{2, -1, false, "0|1|2|3"},
+		{4, -1, false, "0|1|2|3"},
+		{8, -1, false, "0|1|2|3"},
+		{4, 2, false, ""},
+		{4, 2, true, "0|1|3"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d/%d/%v", tt.concurrency, tt.failing, tt.drop), func(t *testing.T) {
+			setFlag(t, "fetch-concurrency", strconv.Itoa(tt.concurrency))
+			setFlag(t, "drop-failed-sources", strconv.FormatBool(tt.drop))
+			t.Cleanup(func() { sourceHealths = map[string]*sourceHealth{} })
+
+			peak := tt.concurrency
+			if peak > n {
+				peak = n
+			}
+			var inFlight, maxInFlight int32
+			sources := make([]string, n)
+			for i := range sources {
+				i := i
+				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					cur := atomic.AddInt32(&inFlight, 1)
+					defer atomic.AddInt32(&inFlight, -1)
+					for {
+						seen := atomic.LoadInt32(&maxInFlight)
+						if cur <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, cur) {
+							break
+						}
+					}
+					// hold every fetch until as many run as may at once
+					deadline := time.Now().Add(2 * time.Second)
+					for atomic.LoadInt32(&maxInFlight) < int32(peak) && time.Now().Before(deadline) {
+						time.Sleep(time.Millisecond)
+					}
+					// later sources answer first
+					time.Sleep(time.Duration(n-i) * 5 * time.Millisecond)
+					if i == tt.failing {
+						http.Error(w, "broken", 500)
+						return
+					}
+					fmt.Fprintf(w, "%d\n", i)
+				}))
+				t.Cleanup(srv.Close)
+				sources[i] = srv.URL
+			}
+
+			loadPool(t, "previous\n")
+			captureLog(t)
+			err := reloadQuotes(context.Background(), sources)
+			if got := atomic.LoadInt32(&maxInFlight); got != int32(peak) {
+				t.Errorf("%d fetches at once; want %d", got, peak)
+			}
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("loaded %q; want an error", poolTexts())
+				}
+				tt.want = "previous"
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(poolTexts(), "|"); got != tt.want {
+				t.Errorf("pool is %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusRedacted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", 500)
+	}))
+	defer srv.Close()
+	source := strings.Replace(srv.URL, "://", "://user:s3cret@", 1)
+
+	setFlag(t, "breaker-threshold", "1")
+	t.Cleanup(func() {
+		breakers = map[string]*breaker{}
+		sourceHealths = map[string]*sourceHealth{}
+	})
+	loadPool(t, "previous\n")
+	sourceHealths = map[string]*sourceHealth{}
+	captureLog(t)
+	if err := reloadQuotes(context.Background(), []string{source}); err == nil {
+		t.Fatal("reload of a failing source succeeded")
+	}
+
+	rec := httptest.NewRecorder()
+	handleStatus(rec, httptest.NewRequest("GET", "/status", nil))
+	if strings.Contains(rec.Body.String(), "s3cret") {
+		t.Errorf("/status leaks the password: %s", rec.Body)
+	}
+	var got struct {
+		Sources, Breakers []struct{ Source string }
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v in %q", err, rec.Body)
+	}
+	if len(got.Sources) != 1 || len(got.Breakers) != 1 {
+		t.Fatalf("got %+v; want one source and one breaker", got)
+	}
+	want := strings.Replace(srv.URL, "://", "://user:xxxxx@", 1)
+	for _, s := range append(got.Sources, got.Breakers...) {
+		if s.Source != want {
+			t.Errorf("reported source %q; want %q", s.Source, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+//go:build cgo
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// loadQuotesFromSQLite runs the query given in a
+// sqlite://path?query=... source; each row's first column
+// is the quote, and an optional second column its author
+func loadQuotesFromSQLite(ctx context.Context, source string) ([]Quote, error) {
+	path, rawQuery := strings.TrimPrefix(source, "sqlite://"), ""
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path, rawQuery = path[:i], path[i+1:]
+	}
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	query := params.Get("query")
+	if query == "" {
+		return nil, errors.New("missing query in sqlite source: " + source)
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var text, author sql.NullString
+	dest := make([]interface{}, len(cols))
+	for i := range dest {
+		dest[i] = new(interface{})
+	}
+	dest[0] = &text
+	if len(cols) > 1 {
+		dest[1] = &author
+	}
+
+	res, add := collectQuotes(ctx)
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		add(Quote{Text: text.String, Author: author.String})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res.qs, res.err
+}
@@ -0,0 +1,15 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+//go:build !cgo
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// loadQuotesFromSQLite fails, as the SQLite driver needs cgo
+func loadQuotesFromSQLite(ctx context.Context, source string) ([]Quote, error) {
+	return nil, errors.New("built without cgo, so can't read sqlite source: " + source)
+}
@@ -0,0 +1,16 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+//go:build !cgo
+
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSQLiteWithoutCgo(t *testing.T) {
+	if qs, err := loadQuotesFromSQLite(context.Background(), "sqlite:///quotes.db?query=SELECT+text+FROM+quotes"); err == nil {
+		t.Errorf("loaded %q; want an error", qs)
+	}
+}
@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+//go:build cgo
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE quotes (id INTEGER, text TEXT, author TEXT)",
+		"INSERT INTO quotes VALUES (1, 'first quote', 'Someone'), (2, 'second quote', NULL), (3, NULL, 'Nobody'), (4, 'over' || char(10) || 'two lines', '')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	tests := []struct {
+		query string
+		want  string // quotes and authors, or "" for an error
+	}{
+		{"SELECT text FROM quotes WHERE text IS NOT NULL ORDER BY id", `["first quote" "" "second quote" "" "over\ntwo lines" ""]`},
+		{"SELECT text, author FROM quotes ORDER BY id", `["first quote" "Someone" "second quote" "" "over\ntwo lines" ""]`},
+		{"SELECT text, author, id FROM quotes WHERE id = 1", `["first quote" "Someone"]`},
+		{"SELECT text FROM quotes WHERE id > 100", `[]`},
+		{"SELECT nothing FROM nowhere", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			source := "sqlite://" + path
+			if tt.query != "" {
+				source += "?query=" + url.QueryEscape(tt.query)
+			}
+			loadPool(t, "previous\n")
+			err := reloadQuotes(context.Background(), []string{source})
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("loaded %q; want an error", poolTexts())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, q := range pool.Quotes() {
+				got = append(got, q.Text, q.Author)
+			}
+			if fmt.Sprintf("%q", got) != tt.want {
+				t.Errorf("pool is %q; want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// promoteStaging checks the -staging file, if there is one, and
+// renames it over current once it's known to load; a staging file
+// that doesn't is left in place and fails the reload, so the pool
+// in memory and current both stay as they were
+func promoteStaging(ctx context.Context, current string) error {
+	f, err := os.Open(staging)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // nothing staged
+	} else if err != nil {
+		return err
+	}
+	qs, err := parseQuotes(ctx, f)
+	f.Close()
+	if err == nil && len(qs) == 0 {
+		err = errors.New("no quotes")
+	} else if err == nil && pin >= len(qs) {
+		err = fmt.Errorf("pinned quote %d out of range; file has %d quotes", pin, len(qs))
+	}
+	if err != nil {
+		return fmt.Errorf("rejected staging file %s: %v", staging, err)
+	}
+
+	if err := os.Rename(staging, current); err != nil {
+		return err
+	}
+	if verbose {
+		log.Printf("promoted %s to %s\n", staging, current)
+	}
+	return nil
+}
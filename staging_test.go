@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStaging(t *testing.T) {
+	tests := []struct {
+		name    string
+		staged  string // "" for no staging file
+		pin     string
+		want    string // current.txt and the pool afterwards
+		ok      bool
+		promote bool
+	}{
+		{"promoted", "staged quote\n", "", "staged quote\n", true, true},
+		{"nothing staged", "", "", "current quote\n", true, false},
+		{"no quotes", "\n\n", "", "current quote\n", false, false},
+		{"pin out of range", "staged quote\n", "1", "current quote\n", false, false},
+		{"pin in range", "staged quote\n\nanother\n", "1", "staged quote\n\nanother\n", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			current, staged := filepath.Join(dir, "current.txt"), filepath.Join(dir, "staging.txt")
+			if err := ioutil.WriteFile(current, []byte("current quote\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			setFlag(t, "staging", staged)
+			loadPool(t, "current quote\n")
+			if tt.pin != "" {
+				setFlag(t, "pin", tt.pin)
+			}
+			if tt.staged != "" {
+				if err := ioutil.WriteFile(staged, []byte(tt.staged), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := reloadQuotes(context.Background(), []string{current})
+			if ok := err == nil; ok != tt.ok {
+				t.Errorf("reload failed: %v; want ok %v", err, tt.ok)
+			}
+			if got := strings.Join(poolTexts(), "\n\n") + "\n"; got != tt.want {
+				t.Errorf("pool is %q; want %q", got, tt.want)
+			}
+			if got, _ := ioutil.ReadFile(current); string(got) != tt.want {
+				t.Errorf("current.txt is %q; want %q", got, tt.want)
+			}
+			_, err = os.Stat(staged)
+			if left := err == nil; left != (tt.staged != "" && !tt.promote) {
+				t.Errorf("staging file left in place: %v", left)
+			}
+		})
+	}
+}
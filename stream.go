@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	streamClients int32
+
+	// closed on shutdown to end open streams, which would
+	// otherwise hold up srv.Shutdown
+	streamsDone = make(chan struct{})
+)
+
+// handleStream pushes a new quote to the client every streamInterval
+// as a server-sent event, until either the client disconnects or
+// the server shuts down
+func handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(500)
+		return
+	}
+
+	n := atomic.AddInt32(&streamClients, 1)
+	defer atomic.AddInt32(&streamClients, -1)
+	if streamMax > 0 && int(n) > streamMax {
+		w.WriteHeader(503)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// tell clients to reconnect after one interval if we drop them
+	fmt.Fprintf(w, "retry: %d\n\n", streamInterval.Milliseconds())
+
+	t := time.NewTicker(streamInterval)
+	defer t.Stop()
+	for {
+		if _, selection := selectQuote(); selection != nil {
+			q := *selection
+			if sanitizeOutput {
+				q = sanitizeQuote(q)
+			}
+			data := strings.ReplaceAll(q.Text, "\n", "\ndata: ")
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-streamsDone:
+			return
+		case <-t.C:
+		}
+	}
+}
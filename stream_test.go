@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// readEvent reads the next server-sent event's lines
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	lines := []string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+		if line == "\n" {
+			return lines
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+}
+
+func TestStream(t *testing.T) {
+	loadPool(t, "a quote\nover two lines\n")
+	setFlag(t, "stream-interval", "10ms")
+	srv := httptest.NewServer(http.HandlerFunc(handleStream))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type %q; want text/event-stream", ct)
+	}
+	r := bufio.NewReader(resp.Body)
+	if got := readEvent(t, r); len(got) != 1 || got[0] != "retry: 10" {
+		t.Errorf("first event %q; want the retry interval", got)
+	}
+	for i := 0; i < 2; i++ {
+		want := []string{"data: a quote", "data: over two lines"}
+		if got := readEvent(t, r); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("event %d = %q; want %q", i, got, want)
+		}
+	}
+	resp.Body.Close()
+
+	// the handler notices the disconnect by its next tick
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&streamClients) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("stream still open after the client disconnected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStreamLimit(t *testing.T) {
+	loadPool(t, "a quote\n")
+	setFlag(t, "stream-interval", "1h")
+	setFlag(t, "stream-clients", "1")
+	done := streamsDone
+	streamsDone = make(chan struct{})
+	t.Cleanup(func() { streamsDone = done })
+	srv := httptest.NewServer(http.HandlerFunc(handleStream))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	readEvent(t, bufio.NewReader(resp.Body))
+
+	extra, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra.Body.Close()
+	if extra.StatusCode != 503 {
+		t.Errorf("stream beyond -stream-clients: got %d; want 503", extra.StatusCode)
+	}
+
+	// shutting down ends the open stream
+	close(streamsDone)
+	if _, err := ioutil.ReadAll(resp.Body); err != nil {
+		t.Errorf("stream ended with %v on shutdown", err)
+	}
+}
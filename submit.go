@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	maxSubmissionSize = 4 << 10
+	maxSubmissions    = 1000
+)
+
+// submitted counts quotes added since the last reload
+var submitted int
+
+// handleSubmit adds the request body as a quote to the in-memory
+// pool, after the same checks and filters as loaded quotes.
+// Submissions are never persisted and are lost on reload.
+func handleSubmit(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSubmissionSize))
+	if err != nil {
+		w.WriteHeader(413)
+		return
+	}
+	text := strings.TrimRight(string(body), "\r\n")
+	if text == "" {
+		w.WriteHeader(400)
+		return
+	}
+
+	// outside the lock, as -filter-cmd may take a while
+	q, problem := prepareQuote(r.Context(), Quote{Text: text})
+	if problem == "" && (include != nil && !include.MatchString(q.Text) || exclude != nil && exclude.MatchString(q.Text)) {
+		problem = "left out by -include or -exclude"
+	}
+	if problem != "" {
+		if verbose {
+			log.Printf("submission by %s refused: %s\n", r.RemoteAddr, problem)
+		}
+		w.WriteHeader(422)
+		return
+	}
+
+	quotesM.Lock()
+	defer quotesM.Unlock()
+	if submitted >= maxSubmissions {
+		w.WriteHeader(507)
+		return
+	}
+	if dedup {
+		for _, have := range pool.Quotes() {
+			if have.Text == q.Text {
+				w.WriteHeader(409)
+				return
+			}
+		}
+	}
+
+	pool.Add(q)
+	submitted++
+
+	if verbose {
+		log.Println("quote submitted by", r.RemoteAddr)
+	}
+	w.WriteHeader(201)
+}
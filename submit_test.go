@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSubmit(t *testing.T) {
+	setFlag(t, "accept-submissions", "true")
+	tests := []struct {
+		name  string
+		flags map[string]string
+		src   string // loaded before submitting
+		body  string
+		want  int
+		text  string // added to the pool, if any
+	}{
+		{"quote", nil, "", "a submitted quote\n", 201, "a submitted quote"},
+		{"multiline", nil, "", "first\nsecond\r\n", 201, "first\nsecond"},
+		{"empty", nil, "", "\n", 400, ""},
+		{"too large", nil, "", strings.Repeat("x", maxSubmissionSize+1), 413, ""},
+		{"invalid utf-8", nil, "", "caf\xe9\n", 422, ""},
+		{"max quote", map[string]string{"max-quote": "5"}, "", "too long\n", 422, ""},
+		{"trim", map[string]string{"trim": "true"}, "", "  padded\n", 201, "padded"},
+		{"filter", map[string]string{"filter-cmd": "tr a-z A-Z"}, "", "shout\n", 201, "SHOUT"},
+		{"failing filter", map[string]string{"filter-cmd": "exit 1"}, "", "quiet\n", 422, ""},
+		{"excluded", nil, "", "a secret quote\n", 422, ""},
+		{"not included", nil, "", "a public quote\n", 422, ""},
+		{"included", nil, "", "an included quote\n", 201, "an included quote"},
+		{"duplicate", map[string]string{"dedup": "true"}, "loaded\n", "loaded\n", 409, ""},
+		{"duplicate kept", nil, "loaded\n", "loaded\n", 201, "loaded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.flags {
+				setFlag(t, name, value)
+			}
+			switch tt.name {
+			case "excluded":
+				setRegexp(t, &exclude, "secret")
+			case "not included", "included":
+				setRegexp(t, &include, "included")
+			}
+			captureLog(t)
+			loadPool(t, tt.src)
+			before := poolSize()
+			rec := httptest.NewRecorder()
+			handleQuote(rec, httptest.NewRequest("POST", "/", strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Fatalf("got %d; want %d", rec.Code, tt.want)
+			}
+			if tt.text == "" {
+				if n := poolSize(); n != before {
+					t.Errorf("pool has %d quotes after a refused submission; want %d", n, before)
+				}
+				return
+			}
+
+			// the submission is the last quote in the pool
+			if got := poolTexts(); len(got) != before+1 || got[before] != tt.text {
+				t.Errorf("pool is %q after submitting; want it to end in %q", got, tt.text)
+			}
+			if before == 0 {
+				rec = httptest.NewRecorder()
+				handleQuote(rec, httptest.NewRequest("GET", "/", nil))
+				if want := tt.text + "\n"; rec.Code != 200 || rec.Body.String() != want {
+					t.Errorf("got %d %q after submitting; want 200 %q", rec.Code, rec.Body, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSubmitLostOnReload(t *testing.T) {
+	setFlag(t, "accept-submissions", "true")
+	for _, skip := range []string{"false", "true"} {
+		t.Run("skip unchanged "+skip, func(t *testing.T) {
+			setFlag(t, "skip-unchanged", skip)
+			files := writeSources(t, "a quote\n")
+			loadPool(t, "")
+			if err := reloadQuotes(context.Background(), files); err != nil {
+				t.Fatal(err)
+			}
+			handleQuote(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("submitted")))
+			if got := poolTexts(); len(got) != 2 {
+				t.Fatalf("pool is %q after submitting", got)
+			}
+
+			if err := reloadQuotes(context.Background(), files); err != nil {
+				t.Fatal(err)
+			}
+			if got := poolTexts(); len(got) != 1 || got[0] != "a quote" {
+				t.Errorf("pool is %q after reloading; want only the loaded quote", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/syslog"
+)
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":   syslog.LOG_KERN,
+	"user":   syslog.LOG_USER,
+	"mail":   syslog.LOG_MAIL,
+	"daemon": syslog.LOG_DAEMON,
+	"auth":   syslog.LOG_AUTH,
+	"syslog": syslog.LOG_SYSLOG,
+	"lpr":    syslog.LOG_LPR,
+	"news":   syslog.LOG_NEWS,
+	"uucp":   syslog.LOG_UUCP,
+	"cron":   syslog.LOG_CRON,
+	"local0": syslog.LOG_LOCAL0,
+	"local1": syslog.LOG_LOCAL1,
+	"local2": syslog.LOG_LOCAL2,
+	"local3": syslog.LOG_LOCAL3,
+	"local4": syslog.LOG_LOCAL4,
+	"local5": syslog.LOG_LOCAL5,
+	"local6": syslog.LOG_LOCAL6,
+	"local7": syslog.LOG_LOCAL7,
+}
+
+// network and address of the syslog daemon;
+// empty for the local one
+var syslogNetwork, syslogAddr string
+
+// useSyslog sends all logs, access logs included, to the local
+// syslog daemon; if it can't be reached, logs stay on stderr
+func useSyslog(facility, tag string) error {
+	f, ok := syslogFacilities[facility]
+	if !ok {
+		return fmt.Errorf("unknown syslog facility: %s", facility)
+	}
+	w, err := syslog.Dial(syslogNetwork, syslogAddr, f|syslog.LOG_INFO, tag)
+	if err != nil {
+		log.Printf("can't reach syslog, logging to stderr: %v\n", err)
+		return nil
+	}
+	log.SetOutput(w)
+	log.SetFlags(0) // syslog timestamps messages itself
+	return nil
+}
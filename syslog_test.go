@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpqotdd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "log")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		facility string
+		addr     string
+		err      bool
+		want     string // start of the syslog message, if any
+	}{
+		{"daemon", "daemon", addr, false, "<30>"},
+		{"local0", "local0", addr, false, "<134>"},
+		{"unknown facility", "nonsense", addr, true, ""},
+		{"unreachable", "daemon", filepath.Join(dir, "missing"), false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			syslogNetwork, syslogAddr = "unixgram", tt.addr
+			stderr := captureLog(t)
+			t.Cleanup(func() {
+				syslogNetwork, syslogAddr = "", ""
+				log.SetFlags(log.LstdFlags)
+			})
+			if err := useSyslog(tt.facility, "qotd-test"); (err != nil) != tt.err {
+				t.Fatalf("got %v; want an error: %v", err, tt.err)
+			}
+			log.Println("hello, syslog")
+
+			if tt.want == "" {
+				// logs stay on stderr
+				if !strings.Contains(stderr.String(), "hello, syslog") {
+					t.Errorf("stderr has %q", stderr)
+				}
+				return
+			}
+			server.SetReadDeadline(time.Now().Add(time.Second))
+			buf := make([]byte, 1024)
+			n, err := server.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := string(buf[:n])
+			if !strings.HasPrefix(msg, tt.want) || !strings.Contains(msg, " qotd-test[") ||
+				!strings.HasSuffix(msg, ": hello, syslog\n") {
+				t.Errorf("syslog got %q; want %s… qotd-test[pid]: hello, syslog", msg, tt.want)
+			}
+			if stderr.String() != "" {
+				t.Errorf("stderr has %q", stderr)
+			}
+		})
+	}
+}
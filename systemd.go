@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// first file descriptor passed by systemd, see sd_listen_fds(3)
+const listenFdsStart = 3
+
+// activationListeners returns the sockets passed by systemd socket
+// activation or a -hup-restart parent, keyed by their LISTEN_FDNAMES
+// name, or none if the process wasn't passed any
+func activationListeners() (map[string][]net.Listener, error) {
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if pid != os.Getpid() && os.Getenv(restartParentEnv) == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// don't pass the sockets on to child processes like git
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	os.Unsetenv(restartParentEnv)
+
+	listeners := map[string][]net.Listener{}
+	for i := 0; i < n; i++ {
+		f := os.NewFile(uintptr(listenFdsStart+i), "LISTEN_FD_"+strconv.Itoa(listenFdsStart+i))
+		l, err := net.FileListener(f)
+		f.Close() // FileListener works on a dup
+		if err != nil {
+			return nil, fmt.Errorf("socket activation: fd %d: %v", listenFdsStart+i, err)
+		}
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		listeners[name] = append(listeners[name], l)
+	}
+	return listeners, nil
+}
+
+// sdNotify sends a state change like "READY=1" to the service
+// manager, if it asked for them; see sd_notify(3)
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	if socket[0] == '@' {
+		// abstract namespace
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		log.Println("sd_notify:", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		log.Println("sd_notify:", err)
+	}
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSocketActivation(t *testing.T) {
+	tests := []struct {
+		name  string
+		names string // LISTEN_FDNAMES
+		http  int    // how many of the sockets serve HTTP
+	}{
+		{"unnamed", "", 2},
+		{"named", "http:other", 2},
+		{"gopher", "http:gopher", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, port := []string{}, freePort(t)
+			d := daemonCommand(t, "-port", port, writeSources(t, "a quote\n")[0])
+			for i := 0; i < 2; i++ {
+				l, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				f, err := l.(*net.TCPListener).File()
+				l.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				addrs = append(addrs, l.Addr().String())
+				d.cmd.ExtraFiles = append(d.cmd.ExtraFiles, f)
+			}
+			d.cmd.Env = append(d.cmd.Env, "LISTEN_FDS=2", "LISTEN_FDNAMES="+tt.names)
+			d.start(t)
+			d.await(t, "READY=1")
+
+			for _, addr := range addrs[:tt.http] {
+				if code, body := fetch(t, "http://"+addr+"/quote"); code != 200 || body != "a quote\n" {
+					t.Errorf("%s: got %d %q; want the quote", addr, code, body)
+				}
+			}
+			for _, addr := range addrs[tt.http:] {
+				conn, err := net.Dial("tcp", addr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				conn.Write([]byte("\r\n"))
+				got, _ := ioutil.ReadAll(conn)
+				conn.Close()
+				if string(got) != "a quote\r\n.\r\n" {
+					t.Errorf("%s: got %q over gopher", addr, got)
+				}
+			}
+			// -port is ignored in favour of the passed sockets
+			if _, err := http.Get("http://127.0.0.1:" + port + "/quote"); err == nil {
+				t.Errorf("served on -port %s too", port)
+			}
+		})
+	}
+}
+
+func TestSocketActivationOtherPID(t *testing.T) {
+	// sockets meant for another process are left alone
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	ls, err := activationListeners()
+	if err != nil || ls != nil {
+		t.Errorf("got %v, %v; want no listeners", ls, err)
+	}
+	if os.Getenv("LISTEN_FDS") != "1" {
+		t.Error("LISTEN_FDS unset")
+	}
+}
+
+func TestSdNotify(t *testing.T) {
+	sockets := map[string]string{
+		"path":     filepath.Join(t.TempDir(), "notify"),
+		"abstract": "@httpqotdd-test-" + strconv.Itoa(os.Getpid()),
+	}
+	for kind, name := range sockets {
+		name := name
+		t.Run(kind, func(t *testing.T) {
+			conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: name, Net: "unixgram"})
+			if err != nil {
+				t.Skip(err)
+			}
+			defer conn.Close()
+			t.Setenv("NOTIFY_SOCKET", name)
+			sdNotify("READY=1")
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			buf := make([]byte, 64)
+			n, err := conn.Read(buf)
+			if err != nil || string(buf[:n]) != "READY=1" {
+				t.Errorf("read %q, %v; want READY=1", buf[:n], err)
+			}
+		})
+	}
+
+	// the daemon reports the whole lifecycle
+	d := startDaemon(t, "-port", freePort(t), writeSources(t, "a quote\n")[0])
+	d.cmd.Process.Signal(syscall.SIGTERM)
+	d.await(t, "STOPPING=1")
+	if err := d.wait(t); err != nil {
+		t.Errorf("exited with %v", err)
+	}
+}
+
+func TestSdNotifyUnset(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	logged := captureLog(t)
+	sdNotify("READY=1")
+	if logged.String() != "" {
+		t.Errorf("logged %q", logged)
+	}
+}
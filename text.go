@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// wrapText word-wraps each line of s to at most width columns;
+// existing newlines are kept, and words longer than width are
+// put on a line of their own rather than being split
+func wrapText(s string, width int) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = wrapLine(line, width)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func wrapLine(line string, width int) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+
+	var b strings.Builder
+	col := 0
+	for _, word := range strings.Fields(line) {
+		n := utf8.RuneCountInString(word)
+		if col > 0 && col+1+n > width {
+			b.WriteByte('\n')
+			col = 0
+		} else if col > 0 {
+			b.WriteByte(' ')
+			col++
+		}
+		b.WriteString(word)
+		col += n
+	}
+	return b.String()
+}
+
+// preview shortens s to a single line of at most n characters
+func preview(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n]) + "…"
+}
+
+// sanitize strips control characters other than newlines and
+// tabs, so quotes can't send escape sequences to terminals
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// sanitizeQuote sanitizes every field of q that gets served
+func sanitizeQuote(q Quote) Quote {
+	q.Text = sanitize(q.Text)
+	q.Author = sanitize(q.Author)
+	q.Category = sanitize(q.Category)
+	q.Type = sanitize(q.Type)
+	return q
+}
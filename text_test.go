@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWrapText(t *testing.T) {
+	paragraph := "It was the best of times, it was the worst of times, it was the age of wisdom, it was the age of foolishness, it was the epoch of belief."
+	tests := []struct {
+		name  string
+		text  string
+		width int
+		want  string
+	}{
+		{"40 columns", paragraph, 40, "It was the best of times, it was the\n" +
+			"worst of times, it was the age of\n" +
+			"wisdom, it was the age of foolishness,\n" +
+			"it was the epoch of belief."},
+		{"80 columns", paragraph, 80, "It was the best of times, it was the worst of times, it was the age of wisdom,\n" +
+			"it was the age of foolishness, it was the epoch of belief."},
+		{"short", "fits", 40, "fits"},
+		{"paragraphs", "one two three\n\nfour five six", 9, "one two\nthree\n\nfour five\nsix"},
+		{"long word", "a supercalifragilisticexpialidocious word", 10, "a\nsupercalifragilisticexpialidocious\nword"},
+		{"runes", "ääää ööö üü", 8, "ääää ööö\nüü"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wrapText(tt.text, tt.width)
+			if got != tt.want {
+				t.Errorf("wrapText(%q, %d) =\n%s\nwant\n%s", tt.text, tt.width, got, tt.want)
+			}
+			for _, line := range strings.Split(got, "\n") {
+				if utf8.RuneCountInString(line) > tt.width && strings.Contains(line, " ") {
+					t.Errorf("line %q is wider than %d columns", line, tt.width)
+				}
+			}
+		})
+	}
+}
+
+func TestWrapFlag(t *testing.T) {
+	loadPool(t, "one two three four\n")
+	tests := []struct {
+		wrap string
+		want string
+	}{
+		{"0", "one two three four\n"},
+		{"9", "one two\nthree\nfour\n"},
+	}
+	for _, tt := range tests {
+		setFlag(t, "wrap", tt.wrap)
+		rec := httptest.NewRecorder()
+		handleQuote(rec, httptest.NewRequest("GET", "/quote", nil))
+		if rec.Body.String() != tt.want {
+			t.Errorf("-wrap %s: got %q; want %q", tt.wrap, rec.Body, tt.want)
+		}
+	}
+}
+
+func TestPreview(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly ten", 11, "exactly ten"},
+		{"a rather long quote", 10, "a rather l…"},
+		{"two\nlines", 20, "two lines"},
+		{"äöüäöü", 3, "äöü…"},
+		{"anything", 0, "…"},
+	}
+	for _, tt := range tests {
+		if got := preview(tt.s, tt.n); got != tt.want {
+			t.Errorf("preview(%q, %d) = %q; want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"plain text", "plain text"},
+		{"two\nlines\twith a tab", "two\nlines\twith a tab"},
+		{"\x1b[31mred\x1b[0m", "[31mred[0m"},
+		{"bell\a and\r carriage\x00 return", "bell and carriage return"},
+		{"\u009b31m C1 control", "31m C1 control"},
+		{"ünïcödé", "ünïcödé"},
+	}
+	for _, tt := range tests {
+		if got := sanitize(tt.s); got != tt.want {
+			t.Errorf("sanitize(%q) = %q; want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeOutput(t *testing.T) {
+	setFlag(t, "sanitize", "true")
+	loadPool(t, "@author: Ev\x1bil\a\nan \x1b[2Jescape\n\n@author: Evil\nanother\n")
+	h := func(handler http.HandlerFunc, url string) func() string {
+		return func() string {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest("GET", url, nil))
+			return rec.Body.String()
+		}
+	}
+	for name, get := range map[string]func() string{
+		"quote":   h(handleQuote, "/quote"),
+		"json":    h(formatHandler("json"), "/quote.json"),
+		"authors": h(handleAuthors, "/authors"),
+		"quotes":  h(handleQuotes, "/quotes?n=2"),
+		"all":     h(handleAll, "/all"),
+		"by":      h(handleByAuthor, "/by/Evil"),
+		"gopher": func() string {
+			client, server := net.Pipe()
+			go handleGopher(server)
+			client.Write([]byte("\r\n"))
+			body, _ := ioutil.ReadAll(client)
+			return string(body)
+		},
+	} {
+		for i := 0; i < 10; i++ {
+			body := get()
+			if strings.ContainsAny(body, "\x1b\a") || strings.Contains(body, `\u001b`) {
+				t.Errorf("%s: served %q", name, body)
+				break
+			}
+		}
+	}
+
+	// only differing in control characters, they're the same author
+	rec := httptest.NewRecorder()
+	handleAuthors(rec, httptest.NewRequest("GET", "/authors", nil))
+	if rec.Body.String() != "Evil\n" {
+		t.Errorf("authors %q; want one", rec.Body)
+	}
+}
@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUI(t *testing.T) {
+	file := writeSources(t, "a quote\n")[0]
+	tests := []struct {
+		flags []string
+		want  int
+	}{
+		{nil, 404},
+		{[]string{"-ui"}, 200},
+	}
+	for _, tt := range tests {
+		port := freePort(t)
+		startDaemon(t, append(append([]string{"-port", port}, tt.flags...), file)...)
+		code, body := fetch(t, "http://127.0.0.1:"+port+"/ui")
+		if code != tt.want {
+			t.Errorf("%v: /ui answered %d; want %d", tt.flags, code, tt.want)
+		}
+		if tt.want == 200 && (!strings.Contains(body, "<html") || !strings.Contains(body, "/quote.json")) {
+			t.Errorf("/ui isn't a page fetching /quote.json:\n%s", body)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errUnchanged is returned along with the previously loaded
+// quotes when a source hasn't changed since the last load
+var errUnchanged = errors.New("source unchanged")
+
+// sourceVersion identifies the content last loaded from a source
+type sourceVersion struct {
+	target  string // file a symlinked source resolved to
+	modTime time.Time
+	size    int64
+
+	etag         string
+	lastModified string
+	freshUntil   time.Time // per Cache-Control max-age
+
+	quotes []Quote
+}
+
+var (
+	versions  = map[string]sourceVersion{}
+	versionsM sync.Mutex
+)
+
+func lastVersion(source string) (sourceVersion, bool) {
+	versionsM.Lock()
+	defer versionsM.Unlock()
+	v, ok := versions[source]
+	return v, ok && skipUnchanged
+}
+
+func storeVersion(source string, v sourceVersion) {
+	if !skipUnchanged && !respectCache {
+		return
+	}
+	versionsM.Lock()
+	versions[source] = v
+	versionsM.Unlock()
+}
+
+// freshQuotes returns the quotes last loaded from a URL source if,
+// with -respect-cache-headers, its origin said they're still fresh
+func freshQuotes(url string) ([]Quote, bool) {
+	if !respectCache {
+		return nil, false
+	}
+	versionsM.Lock()
+	defer versionsM.Unlock()
+	v, ok := versions[url]
+	return v.quotes, ok && time.Now().Before(v.freshUntil)
+}
+
+// freshUntil is when a response stops being fresh by its
+// Cache-Control max-age, or now if it has none
+func freshUntil(h http.Header) time.Time {
+	now := time.Now()
+	maxAge := -1
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if directive == "no-cache" || directive == "no-store" {
+			return now
+		}
+		if strings.HasPrefix(directive, "max-age=") {
+			if n, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil {
+				maxAge = n
+			}
+		}
+	}
+	if maxAge <= 0 {
+		return now
+	}
+	// the response may have aged in a cache on the way
+	if age, err := strconv.Atoi(h.Get("Age")); err == nil && age > 0 {
+		maxAge -= age
+	}
+	return now.Add(time.Duration(maxAge) * time.Second)
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSkipUnchanged(t *testing.T) {
+	// content, ETag and Last-Modified of the URL source
+	var body, etag, lastModified string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if etag != "" && r.Header.Get("If-None-Match") == etag ||
+			lastModified != "" && r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		if lastModified != "" {
+			w.Header().Set("Last-Modified", lastModified)
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	const monday, tuesday = "Mon, 12 Oct 2026 00:00:00 GMT", "Tue, 13 Oct 2026 00:00:00 GMT"
+	tests := []struct {
+		name    string
+		url     bool
+		etag    string // initially, for URL sources
+		lastMod string
+		change  func(file string)
+		want    string
+		skipped bool
+	}{
+		{"file unchanged", false, "", "", func(string) {}, "old quote", true},
+		{"file rewritten", false, "", "", func(file string) {
+			ioutil.WriteFile(file, []byte("new quote\n"), 0644)
+			os.Chtimes(file, time.Now(), time.Now().Add(time.Second))
+		}, "new quote", false},
+		{"file touched", false, "", "", func(file string) {
+			os.Chtimes(file, time.Now(), time.Now().Add(time.Second))
+		}, "old quote", false},
+		{"etag unchanged", true, `"1"`, "", func(string) {}, "old quote", true},
+		{"etag changed", true, `"1"`, "", func(string) { etag, body = `"2"`, "new quote\n" }, "new quote", false},
+		{"last-modified unchanged", true, "", monday, func(string) {}, "old quote", true},
+		{"last-modified changed", true, "", monday, func(string) { lastModified, body = tuesday, "new quote\n" }, "new quote", false},
+		{"no validators", true, "", "", func(string) {}, "old quote", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "skip-unchanged", "true")
+			source := writeSources(t, "old quote\n")[0]
+			if tt.url {
+				// a path of its own, as versions are kept by source
+				source = srv.URL + "/" + strings.ReplaceAll(tt.name, " ", "-")
+			}
+			body, etag, lastModified = "old quote\n", tt.etag, tt.lastMod
+			loadPool(t, "")
+			if err := reloadQuotes(context.Background(), []string{source}); err != nil {
+				t.Fatal(err)
+			}
+			before := pool.Snapshot()
+
+			setFlag(t, "verbose", "true")
+			logged := captureLog(t)
+			tt.change(source)
+			if err := reloadQuotes(context.Background(), []string{source}); err != nil {
+				t.Fatal(err)
+			}
+			if skipped := pool.Snapshot() == before; skipped != tt.skipped {
+				t.Errorf("reload skipped: %v; want %v", skipped, tt.skipped)
+			}
+			if logs := strings.Contains(logged.String(), "source unchanged"); logs != tt.skipped {
+				t.Errorf("logged %q", logged)
+			}
+			if got := poolTexts(); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("pool is %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRespectCacheHeaders(t *testing.T) {
+	// fetches of each path, and the headers to answer them with
+	fetches := map[string]int{}
+	headers := map[string][2]string{}
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches[r.URL.Path]++
+		n, h := fetches[r.URL.Path], headers[r.URL.Path]
+		mu.Unlock()
+		if h[0] != "" {
+			w.Header().Set("Cache-Control", h[0])
+		}
+		if h[1] != "" {
+			w.Header().Set("Age", h[1])
+		}
+		fmt.Fprintf(w, "fetch %d\n", n)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		respect      string
+		cacheControl string
+		age          string
+		wait         time.Duration // before the last reload
+		want         int           // fetches in three reloads
+	}{
+		{"fresh", "true", "max-age=3600", "", 0, 1},
+		{"ignored", "false", "max-age=3600", "", 0, 3},
+		{"no header", "true", "", "", 0, 3},
+		{"zero max-age", "true", "max-age=0", "", 0, 3},
+		{"no-cache", "true", "no-cache, max-age=3600", "", 0, 3},
+		{"aged", "true", "public, max-age=3600", "3599", 1100 * time.Millisecond, 2},
+		{"expired", "true", "max-age=1", "", 1100 * time.Millisecond, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "respect-cache-headers", tt.respect)
+			path := "/" + strings.ReplaceAll(tt.name, " ", "-")
+			mu.Lock()
+			headers[path] = [2]string{tt.cacheControl, tt.age}
+			mu.Unlock()
+			loadPool(t, "")
+			for i := 0; i < 3; i++ {
+				if i == 2 {
+					time.Sleep(tt.wait)
+				}
+				if err := reloadQuotes(context.Background(), []string{srv.URL + path}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			mu.Lock()
+			n := fetches[path]
+			mu.Unlock()
+			if n != tt.want {
+				t.Errorf("fetched %d times; want %d", n, tt.want)
+			}
+			// the pool is what was fetched last
+			if got, want := poolTexts(), fmt.Sprintf("fetch %d", n); len(got) != 1 || got[0] != want {
+				t.Errorf("pool is %q; want %q", got, want)
+			}
+		})
+	}
+}
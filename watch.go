@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// how long to wait for a burst of file events to settle
+const watchDebounce = 250 * time.Millisecond
+
+var (
+	watchTimer *time.Timer
+	watchM     sync.Mutex
+)
+
+// watchSources requests a reload whenever one of the file sources
+// changes. Their directories are watched rather than the files,
+// so that editors' and deploy tools' atomic renames are seen.
+func watchSources(sources []string) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	files := map[string]bool{}
+	for _, source := range sources {
+		if strings.Contains(source, "://") || strings.HasPrefix(source, "git+") {
+			continue
+		}
+		path, err := filepath.Abs(source)
+		if err != nil {
+			return err
+		}
+		if !files[path] {
+			files[path] = true
+			if err := w.Add(filepath.Dir(path)); err != nil {
+				return err
+			}
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case ev := <-w.Events:
+				if files[ev.Name] {
+					debounceReload()
+				}
+			case err := <-w.Errors:
+				log.Println(err)
+			}
+		}
+	}()
+	return nil
+}
+
+func debounceReload() {
+	watchM.Lock()
+	defer watchM.Unlock()
+	if watchTimer != nil {
+		watchTimer.Stop()
+	}
+	watchTimer = time.AfterFunc(watchDebounce, func() {
+		requestReload()
+	})
+}
+
+// forceReload requests a reload right away, dropping any
+// reload still waiting for file events to settle
+func forceReload() <-chan error {
+	watchM.Lock()
+	if watchTimer != nil {
+		watchTimer.Stop()
+		watchTimer = nil
+	}
+	watchM.Unlock()
+	return requestReload()
+}
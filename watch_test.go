@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(file string)
+		hup    bool
+	}{
+		{"rewrite", func(file string) { ioutil.WriteFile(file, []byte("new quote\n"), 0644) }, false},
+		{"rename", func(file string) {
+			ioutil.WriteFile(file+".tmp", []byte("new quote\n"), 0644)
+			os.Rename(file+".tmp", file)
+		}, false},
+		// SIGHUP cuts the debounce short, rather than adding a reload
+		{"SIGHUP while settling", func(file string) { ioutil.WriteFile(file, []byte("new quote\n"), 0644) }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "quotes.txt")
+			ioutil.WriteFile(file, []byte("old quote\n"), 0644)
+			port := freePort(t)
+			d := startDaemon(t, "-port", port, "-watch", "-verbose", file)
+			reloads := func() int { return strings.Count(d.log.String(), "quotes reloaded") }
+			d.awaitLog(t, "quotes reloaded")
+			initial := reloads()
+
+			tt.change(file)
+			if tt.hup {
+				time.Sleep(watchDebounce / 5)
+				d.cmd.Process.Signal(syscall.SIGHUP)
+			}
+			time.Sleep(3 * watchDebounce)
+			if n := reloads() - initial; n != 1 {
+				t.Errorf("reloaded %d times; want once", n)
+			}
+			if _, body := fetch(t, "http://127.0.0.1:"+port+"/quote"); body != "new quote\n" {
+				t.Errorf("got %q; want the new quote", body)
+			}
+		})
+	}
+}
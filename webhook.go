@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// notifyWebhook POSTs a newly selected quote to -webhook in the
+// background, so a slow receiver never holds up serving
+func notifyWebhook(event string, idx int, q *Quote) {
+	if webhook == "" || q == nil {
+		return
+	}
+	body, err := json.Marshal(struct {
+		Event string `json:"event"`
+		Index int    `json:"index"`
+		Quote Quote  `json:"quote"`
+	}{event, idx, *q})
+	if err != nil {
+		log.Println("webhook:", err)
+		return
+	}
+
+	go func() {
+		req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+		if err != nil {
+			log.Println("webhook:", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if fetchUserAgent != "" {
+			req.Header.Set("User-Agent", fetchUserAgent)
+		}
+		resp, err := webhookClient.Do(req)
+		if err != nil {
+			log.Println("webhook:", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			log.Printf("webhook: %s answered %d\n", webhook, resp.StatusCode)
+		}
+	}()
+}
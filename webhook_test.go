@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type webhookEvent struct {
+	Event string `json:"event"`
+	Index int    `json:"index"`
+	Quote Quote  `json:"quote"`
+}
+
+// webhookReceiver answers POSTs after delay with status,
+// passing each payload on to the returned channel
+func webhookReceiver(t *testing.T, status int, delay time.Duration) (*httptest.Server, chan webhookEvent) {
+	events := make(chan webhookEvent, 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var e webhookEvent
+		if err := json.Unmarshal(body, &e); err != nil || r.Method != http.MethodPost ||
+			r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s %q, %v", r.Method, body, err)
+		}
+		time.Sleep(delay)
+		w.WriteHeader(status)
+		events <- e
+	}))
+	t.Cleanup(srv.Close)
+	return srv, events
+}
+
+func awaitWebhook(t *testing.T, events chan webhookEvent) webhookEvent {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+		return webhookEvent{}
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		delay  time.Duration
+		logged string
+	}{
+		{"ok", 204, 0, ""},
+		{"failing", 500, 0, "answered 500"},
+		// serving doesn't wait for the receiver
+		{"slow", 200, 500 * time.Millisecond, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, events := webhookReceiver(t, tt.status, tt.delay)
+			setFlag(t, "webhook", srv.URL)
+			logged := captureLog(t)
+			loadPool(t, "")
+
+			start := time.Now()
+			if err := reloadQuotes(context.Background(), writeSources(t, "a quote\n")); err != nil {
+				t.Fatal(err)
+			}
+			if elapsed := time.Since(start); elapsed >= tt.delay && tt.delay > 0 {
+				t.Errorf("reload took %v, waiting for the webhook", elapsed)
+			}
+			e := awaitWebhook(t, events)
+			if e.Event != "reload" || e.Index != 0 || e.Quote.Text != "a quote" {
+				t.Errorf("got %+v; want the reloaded quote", e)
+			}
+			// the log line follows the response
+			time.Sleep(50 * time.Millisecond)
+			if got := logged.String(); tt.logged == "" && got != "" || !strings.Contains(got, tt.logged) {
+				t.Errorf("logged %q; want %q", got, tt.logged)
+			}
+		})
+	}
+}
+
+func TestWebhookReselect(t *testing.T) {
+	srv, events := webhookReceiver(t, 200, 0)
+	startDaemon(t, "-port", freePort(t), "-cache", "50ms", "-webhook", srv.URL, writeSources(t, "a quote\n")[0])
+	if e := awaitWebhook(t, events); e.Event != "reload" {
+		t.Errorf("got %+v first; want the initial load", e)
+	}
+	for i := 0; i < 2; i++ {
+		if e := awaitWebhook(t, events); e.Event != "reselect" || e.Quote.Text != "a quote" {
+			t.Errorf("got %+v; want the reselected quote", e)
+		}
+	}
+}